@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"waf-admin/internal/config"
+
+	"github.com/spf13/viper"
+)
+
+const configUsage = `Usage: waf-admin config <command> [-config path]
+
+Commands:
+  validate   check the configuration and list every problem found
+  dump       print the effective configuration with secrets redacted
+  env        list the environment variables that override each setting
+`
+
+// runConfigCommand implements "waf-admin config validate|dump" and returns
+// the process exit code
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, configUsage)
+		return 2
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet("config "+command, flag.ContinueOnError)
+	path := flags.String("config", "", "path to config.yaml (default: search ., ./config and /etc/waf-admin)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	config.SetConfigFile(*path)
+
+	switch command {
+	case "validate":
+		if _, err := config.LoadConfig(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("%s: configuration is valid\n", configSource())
+		return 0
+	case "dump":
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		out, err := cfg.EffectiveYAML()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to render config: %v\n", err)
+			return 1
+		}
+		fmt.Printf("# effective configuration from %s\n%s", configSource(), out)
+		return 0
+	case "env":
+		for _, key := range config.EnvKeys() {
+			fmt.Printf("%-50s %s\n", config.EnvName(key), key)
+		}
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown config command %q\n\n%s", command, configUsage)
+		return 2
+	}
+}
+
+func configSource() string {
+	if file := viper.ConfigFileUsed(); file != "" {
+		return file
+	}
+	return "defaults and environment"
+}
@@ -2,24 +2,34 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
 	"syscall"
 	"time"
 
 	"waf-admin/internal/api"
+	"waf-admin/internal/auth"
+	"waf-admin/internal/certs"
 	"waf-admin/internal/config"
 	"waf-admin/internal/k8s"
 	"waf-admin/internal/models"
 	"waf-admin/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:]))
+	}
+
 	logger := logrus.New()
 	logger.SetFormatter(&logrus.JSONFormatter{})
 
@@ -41,21 +51,61 @@ func main() {
 		logger.Fatalf("Failed to create Kubernetes client: %v", err)
 	}
 
+	// Fill credentials from security.secret_ref
+	if err := cfg.ResolveSecretRef(context.Background(), k8sClient); err != nil {
+		logger.Fatalf("Failed to load credentials: %v", err)
+	}
+
 	// Initialize services
 	wafService := services.NewWAFService(k8sClient, cfg, logger)
 	auditService := services.NewAuditService(cfg, logger)
 	metricsService := services.NewMetricsService(cfg, logger)
 	logsService := services.NewLogsService(cfg, logger)
+	wafEventsExporter := services.NewWAFEventsExporter(cfg, logger)
+	healthService := services.NewHealthService(k8sClient, cfg, logger)
+	alertsService := services.NewAlertsService(cfg, logger)
+	alertRulesService := services.NewAlertRulesService(k8sClient, alertsService, cfg, logger)
+	silencesService := services.NewSilencesService(k8sClient, cfg, logger)
+	alertsService.SetSilencesService(silencesService)
+	notifier := services.NewNotifier(alertsService, cfg, logger)
 
 	// Set audit service for WAF service
 	wafService.SetAuditService(auditService)
+	alertRulesService.SetAuditService(auditService)
+	silencesService.SetAuditService(auditService)
+	logsService.SetAuditService(auditService)
+	auditService.SetNotifier(notifier)
+	wafService.SetNotifier(notifier)
+
+	// Initialize authentication
+	authenticator, err := auth.NewAuthenticator(context.Background(), cfg, logger)
+	if err != nil {
+		logger.Fatalf("Failed to initialize authentication: %v", err)
+	}
+	authenticator.SetKubernetesReviewer(k8sClient)
+	wafService.SetAuthenticator(authenticator)
 
 	// Initialize handlers
 	wafHandler := api.NewWAFHandler(wafService, logger)
 	auditHandler := api.NewAuditHandler(auditService)
+	authHandler := api.NewAuthHandler(authenticator, logger)
+	metricsHandler := api.NewMetricsHandler(metricsService)
+	healthHandler := api.NewHealthHandler(healthService)
+	alertsHandler := api.NewAlertsHandler(alertsService)
+	alertRulesHandler := api.NewAlertRulesHandler(alertRulesService, logger)
+	silencesHandler := api.NewSilencesHandler(silencesService, logger)
+	notificationsHandler := api.NewNotificationsHandler(notifier)
+	logsHandler := api.NewLogsHandler(logsService)
+
+	// Reload configuration when config.yaml changes
+	config.WatchConfig(func(oldCfg, newCfg *config.Config) error {
+		return reloadConfig(oldCfg, newCfg, authenticator, k8sClient, wafService, metricsService, logsService, wafEventsExporter, healthService, alertsService, alertRulesService, silencesService, notifier, auditService, logger)
+	}, func(err error) {
+		logger.Errorf("Config reload rejected: %v", err)
+	})
 
 	// Setup Gin router
-	router := setupRouter(cfg, wafHandler, auditHandler, metricsService, logsService, logger)
+	router := setupRouter(cfg, authenticator, authHandler, wafHandler, auditHandler, metricsHandler, healthHandler, alertsHandler, alertRulesHandler, silencesHandler, notificationsHandler, logsHandler, logsService, alertRulesService, silencesService, logger)
 
 	// Start server
 	srv := &http.Server{
@@ -63,14 +113,50 @@ func main() {
 		Handler: router,
 	}
 
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+
+	// The exporter checks metrics.waf_events.enabled on every poll, so it
+	// always runs and follows config reloads
+	go wafEventsExporter.Run(watchCtx)
+	go notifier.Run(watchCtx)
+	go wafService.WatchDrift(watchCtx)
+
+	// Read the policies once so the per-mode policy gauges are populated
+	// before the first API call
+	go func() {
+		if _, err := wafService.GetWAFStatus(watchCtx); err != nil {
+			logger.Warnf("Failed to read WAF policies for metrics: %v", err)
+		}
+	}()
+
+	if cfg.Server.TLS.Enabled {
+		reloader, err := certs.NewReloader(cfg.Server.TLS, logger)
+		if err != nil {
+			logger.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		srv.TLSConfig, err = reloader.TLSConfig()
+		if err != nil {
+			logger.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		go reloader.Watch(watchCtx)
+	}
+
 	// Graceful shutdown
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.Server.TLS.Enabled {
+			// Certificates are served by TLSConfig so they can be reloaded
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Fatalf("Failed to start server: %v", err)
 		}
 	}()
 
-	logger.Infof("WAF Admin server started on %s:%d", cfg.Server.Host, cfg.Server.Port)
+	logger.Infof("WAF Admin server started on %s:%d (tls: %t)", cfg.Server.Host, cfg.Server.Port, cfg.Server.TLS.Enabled)
 
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
@@ -89,51 +175,142 @@ func main() {
 	logger.Info("Server exited")
 }
 
-func setupRouter(cfg *config.Config, wafHandler *api.WAFHandler, auditHandler *api.AuditHandler, metricsService *services.MetricsService, logsService *services.LogsService, logger *logrus.Logger) *gin.Engine {
+// reloadConfig propagates a validated configuration to every component. The
+// referenced Secret and the authenticator are handled first because they are
+// the only steps that can fail, so a rejected reload leaves all components on
+// the previous configuration.
+func reloadConfig(oldCfg, newCfg *config.Config, authenticator *auth.Authenticator, k8sClient *k8s.Client, wafService *services.WAFService, metricsService *services.MetricsService, logsService *services.LogsService, wafEventsExporter *services.WAFEventsExporter, healthService *services.HealthService, alertsService *services.AlertsService, alertRulesService *services.AlertRulesService, silencesService *services.SilencesService, notifier *services.Notifier, auditService *services.AuditService, logger *logrus.Logger) error {
+	ctx := context.Background()
+	if err := newCfg.ResolveSecretRef(ctx, k8sClient); err != nil {
+		return err
+	}
+	if err := authenticator.UpdateConfig(ctx, newCfg); err != nil {
+		return err
+	}
+
+	k8sClient.UpdateConfig(newCfg)
+	wafService.UpdateConfig(newCfg)
+	metricsService.UpdateConfig(newCfg)
+	logsService.UpdateConfig(newCfg)
+	wafEventsExporter.UpdateConfig(newCfg)
+	healthService.UpdateConfig(newCfg)
+	alertsService.UpdateConfig(newCfg)
+	alertRulesService.UpdateConfig(newCfg)
+	silencesService.UpdateConfig(newCfg)
+	notifier.UpdateConfig(newCfg)
+
+	if newCfg.Server.Mode == "release" {
+		logger.SetLevel(logrus.InfoLevel)
+	} else {
+		logger.SetLevel(logrus.DebugLevel)
+	}
+	if oldCfg.Server.Host != newCfg.Server.Host || oldCfg.Server.Port != newCfg.Server.Port ||
+		!reflect.DeepEqual(oldCfg.Server.TLS, newCfg.Server.TLS) || !reflect.DeepEqual(oldCfg.Server.AllowOrigins, newCfg.Server.AllowOrigins) ||
+		!reflect.DeepEqual(oldCfg.Server.CORS, newCfg.Server.CORS) {
+		logger.Warn("Listener, TLS and CORS settings changed; they take effect after a restart")
+	}
+
+	logger.Info("Configuration reloaded")
+
+	auditLog := auditService.CreateAuditLog(
+		"RELOAD_CONFIG",
+		"config",
+		viper.ConfigFileUsed(),
+		"system",
+		"",
+		"",
+		oldCfg.Redacted(),
+		newCfg.Redacted(),
+	)
+	if err := auditService.LogChange(ctx, auditLog); err != nil {
+		logger.Warnf("Failed to log audit change: %v", err)
+	}
+
+	return nil
+}
+
+func setupRouter(cfg *config.Config, authenticator *auth.Authenticator, authHandler *api.AuthHandler, wafHandler *api.WAFHandler, auditHandler *api.AuditHandler, metricsHandler *api.MetricsHandler, healthHandler *api.HealthHandler, alertsHandler *api.AlertsHandler, alertRulesHandler *api.AlertRulesHandler, silencesHandler *api.SilencesHandler, notificationsHandler *api.NotificationsHandler, logsHandler *api.LogsHandler, logsService *services.LogsService, alertRulesService *services.AlertRulesService, silencesService *services.SilencesService, logger *logrus.Logger) *gin.Engine {
 	router := gin.New()
-	router.Use(gin.Logger(), gin.Recovery())
+	router.Use(gin.Logger(), api.Recovery(logger), api.Instrument())
 
 	// CORS middleware
-	router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	router.Use(api.NewCORS(cfg.Server, router.Routes).Middleware())
 
-		c.Next()
-	})
+	// Prometheus scrape endpoint, served outside /api so scrapers need no
+	// credentials
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// Kubernetes probes
+	router.GET("/healthz", healthHandler.Liveness)
+	router.GET("/readyz", healthHandler.Readiness)
+
+	// Public routes
+	public := router.Group("/api")
+	{
+		// OIDC login flow
+		public.GET("/auth/login", authHandler.Login)
+		public.GET("/auth/callback", authHandler.Callback)
 
-	// Basic auth middleware if enabled
-	if cfg.Security.EnableAuth {
-		router.Use(gin.BasicAuth(gin.Accounts{
-			cfg.Security.Username: cfg.Security.Password,
-		}))
+		// Kept for existing probes; same as /healthz
+		public.GET("/health", healthHandler.Liveness)
 	}
 
-	// API routes
-	api := router.Group("/api")
+	// API routes (basic auth, bearer JWT or session cookie)
+	api := router.Group("/api", authenticator.Middleware())
 	{
+		// Session
+		api.GET("/auth/me", authHandler.Me)
+		api.POST("/auth/logout", authHandler.Logout)
+
 		// WAF management
 		waf := api.Group("/waf")
 		{
 			waf.GET("/status", wafHandler.GetWAFStatus)
-			waf.POST("/mode", wafHandler.UpdateWAFMode)
-			waf.POST("/exceptions", wafHandler.UpdateExceptions)
-			waf.POST("/rules", wafHandler.UpdateRules)
-			waf.POST("/apply", wafHandler.ApplyConfiguration)
+			waf.GET("/events", logsHandler.GetWAFEvents)
+			waf.POST("/mode", auth.RequireRoleOrDelegated(auth.RoleAdmin), wafHandler.UpdateWAFMode)
+			waf.POST("/exceptions", auth.RequireRoleOrDelegated(auth.RoleAdmin), wafHandler.UpdateExceptions)
+			waf.POST("/rules", auth.RequireRoleOrDelegated(auth.RoleAdmin), wafHandler.UpdateRules)
+			waf.POST("/apply", auth.RequireRoleOrDelegated(auth.RoleAdmin), wafHandler.ApplyConfiguration)
 		}
 
 		// Metrics
 		metrics := api.Group("/metrics")
 		{
-			metrics.GET("/summary", func(c *gin.Context) {
-				handleMetricsSummary(c, metricsService)
-			})
+			metrics.GET("/summary", metricsHandler.GetMetricsSummary)
+			metrics.GET("/timeseries", metricsHandler.GetTimeSeries)
+		}
+
+		// Alerts
+		// Delegated users may change alert rules, silences and
+		// acknowledgements when their own RBAC allows updating the
+		// ConfigMap that holds them. Silences kept in Alertmanager are
+		// governed by no Kubernetes resource and need the admin role.
+		alerts := api.Group("/alerts")
+		editRules := authenticator.RequireRoleOrAccess(auth.RoleAdmin, auth.ConfigMapAccess("update", alertRulesService.ConfigMapRef))
+		editSilencesConfigMap := authenticator.RequireRoleOrAccess(auth.RoleAdmin, auth.ConfigMapAccess("update", silencesService.ConfigMapRef))
+		requireAdmin := auth.RequireRole(auth.RoleAdmin)
+		editSilences := func(c *gin.Context) {
+			if silencesService.UsesAlertmanager() {
+				requireAdmin(c)
+				return
+			}
+			editSilencesConfigMap(c)
+		}
+		{
+			alerts.GET("", alertsHandler.GetAlerts)
+			alerts.GET("/rules", alertRulesHandler.ListRules)
+			alerts.POST("/rules", editRules, alertRulesHandler.CreateRule)
+			alerts.PUT("/rules/:id", editRules, alertRulesHandler.UpdateRule)
+			alerts.POST("/rules/:id/enable", editRules, alertRulesHandler.EnableRule)
+			alerts.POST("/rules/:id/disable", editRules, alertRulesHandler.DisableRule)
+			alerts.DELETE("/rules/:id", editRules, alertRulesHandler.DeleteRule)
+			alerts.GET("/silences", silencesHandler.ListSilences)
+			alerts.POST("/silences", editSilences, silencesHandler.CreateSilence)
+			alerts.DELETE("/silences/:id", editSilences, silencesHandler.ExpireSilence)
+			// Acknowledgements are stored with the local silences, also
+			// when silences are kept in Alertmanager
+			alerts.POST("/acknowledgements", editSilencesConfigMap, alertsHandler.AcknowledgeAlert)
+			alerts.DELETE("/acknowledgements/:id", editSilencesConfigMap, alertsHandler.UnacknowledgeAlert)
 		}
 
 		// Logs
@@ -142,9 +319,9 @@ func setupRouter(cfg *config.Config, wafHandler *api.WAFHandler, auditHandler *a
 			logs.POST("/search", func(c *gin.Context) {
 				handleLogsSearch(c, logsService)
 			})
-			logs.GET("/filters", func(c *gin.Context) {
-				c.JSON(http.StatusOK, logsService.GetLogFilters())
-			})
+			logs.GET("/filters", logsHandler.GetLogFilters)
+			logs.GET("/tail", logsHandler.TailLogs)
+			logs.POST("/export", logsHandler.ExportLogs)
 		}
 
 		// Audit
@@ -154,34 +331,13 @@ func setupRouter(cfg *config.Config, wafHandler *api.WAFHandler, auditHandler *a
 			audit.GET("/:id", auditHandler.GetAuditLog)
 		}
 
-		// Health check
-		api.GET("/health", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{"status": "healthy"})
-		})
+		// Notifications
+		api.GET("/notifications/dead-letters", auth.RequireRole(auth.RoleAdmin), notificationsHandler.GetDeadLetters)
 	}
 
 	return router
 }
 
-func handleMetricsSummary(c *gin.Context, service *services.MetricsService) {
-	var timeRange models.TimeRange
-	if err := c.ShouldBindQuery(&timeRange); err != nil {
-		// Default to last 1 hour
-		timeRange = models.TimeRange{
-			Start: time.Now().Add(-1 * time.Hour),
-			End:   time.Now(),
-		}
-	}
-
-	summary, err := service.GetMetricsSummary(c.Request.Context(), timeRange)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get metrics summary"})
-		return
-	}
-
-	c.JSON(http.StatusOK, summary)
-}
-
 func handleLogsSearch(c *gin.Context, service *services.LogsService) {
 	var query models.LogQuery
 	if err := c.ShouldBindJSON(&query); err != nil {
@@ -190,6 +346,10 @@ func handleLogsSearch(c *gin.Context, service *services.LogsService) {
 	}
 
 	result, err := service.SearchLogs(c.Request.Context(), query)
+	if errors.Is(err, services.ErrInvalidLogQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search logs"})
 		return
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"waf-admin/internal/models"
+	"waf-admin/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type AlertRulesHandler struct {
+	alertRulesService *services.AlertRulesService
+	logger            *logrus.Logger
+}
+
+func NewAlertRulesHandler(alertRulesService *services.AlertRulesService, logger *logrus.Logger) *AlertRulesHandler {
+	return &AlertRulesHandler{
+		alertRulesService: alertRulesService,
+		logger:            logger,
+	}
+}
+
+// ListRules returns the managed rules and the other rules loaded by vmalert,
+// optionally filtered by the state and severity query parameters
+func (h *AlertRulesHandler) ListRules(c *gin.Context) {
+	filter, ok := parseAlertFilter(c, true)
+	if !ok {
+		return
+	}
+
+	rules, err := h.alertRulesService.ListRules(c.Request.Context(), filter)
+	if err != nil {
+		h.logger.Errorf("Failed to list alert rules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list alert rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// CreateRule adds a managed alert rule
+func (h *AlertRulesHandler) CreateRule(c *gin.Context) {
+	var req models.AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.alertRulesService.CreateRule(c.Request.Context(), req)
+	h.respond(c, http.StatusCreated, rule, err)
+}
+
+// UpdateRule replaces a managed alert rule
+func (h *AlertRulesHandler) UpdateRule(c *gin.Context) {
+	var req models.AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.alertRulesService.UpdateRule(c.Request.Context(), c.Param("id"), req)
+	h.respond(c, http.StatusOK, rule, err)
+}
+
+// EnableRule switches a managed alert rule on
+func (h *AlertRulesHandler) EnableRule(c *gin.Context) {
+	rule, err := h.alertRulesService.SetRuleEnabled(c.Request.Context(), c.Param("id"), true)
+	h.respond(c, http.StatusOK, rule, err)
+}
+
+// DisableRule switches a managed alert rule off without deleting it
+func (h *AlertRulesHandler) DisableRule(c *gin.Context) {
+	rule, err := h.alertRulesService.SetRuleEnabled(c.Request.Context(), c.Param("id"), false)
+	h.respond(c, http.StatusOK, rule, err)
+}
+
+// DeleteRule removes a managed alert rule
+func (h *AlertRulesHandler) DeleteRule(c *gin.Context) {
+	err := h.alertRulesService.DeleteRule(c.Request.Context(), c.Param("id"))
+	h.respond(c, http.StatusOK, nil, err)
+}
+
+// respond maps alert rule errors to status codes
+func (h *AlertRulesHandler) respond(c *gin.Context, status int, rule *models.AlertRule, err error) {
+	body := gin.H{"message": "Alert rules updated successfully"}
+	if rule != nil {
+		body["rule"] = rule
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrInvalidAlertRule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrAlertRuleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrAlertRuleConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		h.logger.Errorf("Failed to update alert rules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert rules"})
+		return
+	}
+
+	c.JSON(status, body)
+}
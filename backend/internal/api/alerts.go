@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"waf-admin/internal/models"
+	"waf-admin/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AlertsHandler struct {
+	alertsService *services.AlertsService
+}
+
+func NewAlertsHandler(alertsService *services.AlertsService) *AlertsHandler {
+	return &AlertsHandler{
+		alertsService: alertsService,
+	}
+}
+
+// GetAlerts returns active alerts, optionally filtered by the state,
+// severity and host query parameters. Silenced alerts are only included
+// with silenced=true.
+func (h *AlertsHandler) GetAlerts(c *gin.Context) {
+	filter, ok := parseAlertFilter(c, false)
+	if !ok {
+		return
+	}
+	if raw := c.Query("silenced"); raw != "" {
+		include, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "silenced must be true or false"})
+			return
+		}
+		filter.IncludeSilenced = include
+	}
+
+	alerts, err := h.alertsService.GetAlerts(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to get alerts: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alerts": alerts})
+}
+
+// AcknowledgeAlert records that the requesting user is handling an alert
+func (h *AlertsHandler) AcknowledgeAlert(c *gin.Context) {
+	var req models.AcknowledgementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ack, err := h.alertsService.AcknowledgeAlert(c.Request.Context(), req)
+	if err != nil {
+		respondAcknowledgementError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Alert acknowledged successfully", "acknowledgement": ack})
+}
+
+// UnacknowledgeAlert removes the acknowledgement of an alert
+func (h *AlertsHandler) UnacknowledgeAlert(c *gin.Context) {
+	if err := h.alertsService.UnacknowledgeAlert(c.Request.Context(), c.Param("id")); err != nil {
+		respondAcknowledgementError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Alert acknowledgement removed successfully"})
+}
+
+func respondAcknowledgementError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrAlertNotFound), errors.Is(err, services.ErrAcknowledgementNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSilenceConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlertsUnavailable):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update acknowledgements: " + err.Error()})
+	}
+}
+
+func parseAlertFilter(c *gin.Context, rules bool) (models.AlertFilter, bool) {
+	filter := models.AlertFilter{
+		State:    c.Query("state"),
+		Severity: c.Query("severity"),
+		Host:     c.Query("host"),
+	}
+	if err := services.ValidateAlertFilter(filter, rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return filter, false
+	}
+	return filter, true
+}
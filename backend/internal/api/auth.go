@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+
+	"waf-admin/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type AuthHandler struct {
+	authenticator *auth.Authenticator
+	logger        *logrus.Logger
+}
+
+func NewAuthHandler(authenticator *auth.Authenticator, logger *logrus.Logger) *AuthHandler {
+	return &AuthHandler{
+		authenticator: authenticator,
+		logger:        logger,
+	}
+}
+
+// Login redirects the browser to the OIDC provider
+func (h *AuthHandler) Login(c *gin.Context) {
+	provider := h.authenticator.OIDC()
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC login is not enabled"})
+		return
+	}
+
+	authURL, err := provider.StartLogin(c, h.authenticator.Sessions(), c.DefaultQuery("return_to", "/"))
+	if err != nil {
+		h.logger.Errorf("Failed to start OIDC login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes the OIDC authorization-code flow and starts a session
+func (h *AuthHandler) Callback(c *gin.Context) {
+	provider := h.authenticator.OIDC()
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC login is not enabled"})
+		return
+	}
+
+	user, returnTo, err := provider.FinishLogin(c, h.authenticator.Sessions())
+	if err != nil {
+		h.logger.Warnf("OIDC login failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login failed"})
+		return
+	}
+
+	if len(user.Roles) == 0 {
+		h.logger.Warnf("OIDC user %s has no role mapped from groups %v", user.Name, user.Groups)
+		c.JSON(http.StatusForbidden, gin.H{"error": "No role assigned to user"})
+		return
+	}
+
+	if _, err := h.authenticator.Sessions().Create(c, user); err != nil {
+		h.logger.Errorf("Failed to create session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	h.logger.Infof("User %s logged in via OIDC", user.Name)
+	c.Redirect(http.StatusFound, returnTo)
+}
+
+// Logout clears the session cookies
+func (h *AuthHandler) Logout(c *gin.Context) {
+	h.authenticator.Sessions().Clear(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// Me returns the authenticated user
+func (h *AuthHandler) Me(c *gin.Context) {
+	user, ok := auth.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":         user,
+		"oidc_enabled": h.authenticator.OIDC() != nil,
+	})
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"waf-admin/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS applies the server.cors policy. Origins from server.allow_origins may
+// be exact ("https://waf.local"), wildcard subdomains ("https://*.example.com")
+// or "*". The request origin is only reflected when it is permitted, and
+// credentials are never allowed for the "*" wildcard.
+type CORS struct {
+	allowAll      bool
+	exact         map[string]bool
+	wildcards     []wildcardOrigin
+	allowHeaders  string
+	exposeHeaders string
+	credentials   bool
+	maxAge        string
+
+	routes     func() gin.RoutesInfo
+	routesOnce sync.Once
+	routeTable map[string][]string
+}
+
+type wildcardOrigin struct {
+	scheme string
+	suffix string
+}
+
+// NewCORS builds the CORS policy. routes is called lazily on the first
+// preflight to discover the methods registered for each path.
+func NewCORS(cfg config.ServerConfig, routes func() gin.RoutesInfo) *CORS {
+	c := &CORS{
+		exact:         make(map[string]bool),
+		allowHeaders:  strings.Join(cfg.CORS.AllowHeaders, ", "),
+		exposeHeaders: strings.Join(cfg.CORS.ExposeHeaders, ", "),
+		credentials:   cfg.CORS.AllowCredentials,
+		maxAge:        strconv.Itoa(int(cfg.CORS.MaxAge.Seconds())),
+		routes:        routes,
+	}
+
+	for _, origin := range cfg.AllowOrigins {
+		origin = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+		switch {
+		case origin == "*":
+			c.allowAll = true
+		case strings.Contains(origin, "://*."):
+			scheme, host, _ := strings.Cut(origin, "://")
+			c.wildcards = append(c.wildcards, wildcardOrigin{scheme: scheme, suffix: strings.TrimPrefix(host, "*")})
+		case origin != "":
+			c.exact[origin] = true
+		}
+	}
+
+	return c
+}
+
+// Middleware handles preflight requests and decorates actual responses
+func (c *CORS) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		if origin == "" {
+			ctx.Next()
+			return
+		}
+
+		ctx.Writer.Header().Add("Vary", "Origin")
+		preflight := ctx.Request.Method == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != ""
+
+		allowOrigin, ok := c.allowedOrigin(origin)
+		if !ok {
+			if preflight {
+				ctx.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			ctx.Next()
+			return
+		}
+
+		header := ctx.Writer.Header()
+		header.Set("Access-Control-Allow-Origin", allowOrigin)
+		if c.credentials && allowOrigin != "*" {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if c.exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", c.exposeHeaders)
+			}
+			ctx.Next()
+			return
+		}
+
+		methods := c.methodsFor(ctx.Request.URL.Path)
+		if len(methods) == 0 {
+			ctx.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		header.Set("Access-Control-Allow-Headers", c.allowHeaders)
+		header.Set("Access-Control-Max-Age", c.maxAge)
+		ctx.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// allowedOrigin returns the value for Access-Control-Allow-Origin
+func (c *CORS) allowedOrigin(origin string) (string, bool) {
+	normalized := strings.ToLower(origin)
+	if c.exact[normalized] {
+		return origin, true
+	}
+
+	if len(c.wildcards) > 0 {
+		if u, err := url.Parse(normalized); err == nil && u.Host != "" {
+			for _, w := range c.wildcards {
+				if u.Scheme == w.scheme && strings.HasSuffix(u.Host, w.suffix) && len(u.Host) > len(w.suffix) {
+					return origin, true
+				}
+			}
+		}
+	}
+
+	if c.allowAll {
+		return "*", true
+	}
+	return "", false
+}
+
+// methodsFor returns the methods registered for the path, plus OPTIONS
+func (c *CORS) methodsFor(path string) []string {
+	c.routesOnce.Do(func() {
+		c.routeTable = make(map[string][]string)
+		for _, route := range c.routes() {
+			c.routeTable[route.Path] = append(c.routeTable[route.Path], route.Method)
+		}
+	})
+
+	seen := make(map[string]bool)
+	for pattern, methods := range c.routeTable {
+		if matchRoute(pattern, path) {
+			for _, m := range methods {
+				seen[m] = true
+			}
+		}
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+
+	seen[http.MethodOptions] = true
+	methods := make([]string, 0, len(seen))
+	for m := range seen {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// matchRoute matches a request path against a gin route pattern with
+// :param and *catchall segments
+func matchRoute(pattern, path string) bool {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, part := range patternParts {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(pathParts) {
+			return false
+		}
+		if strings.HasPrefix(part, ":") {
+			if pathParts[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != pathParts[i] {
+			return false
+		}
+	}
+	return len(patternParts) == len(pathParts)
+}
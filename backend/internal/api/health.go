@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+
+	"waf-admin/internal/models"
+	"waf-admin/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	healthService *services.HealthService
+}
+
+func NewHealthHandler(healthService *services.HealthService) *HealthHandler {
+	return &HealthHandler{
+		healthService: healthService,
+	}
+}
+
+// Liveness reports that the process is serving requests. It checks no
+// dependencies so an outage elsewhere never gets the pod restarted.
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// Readiness reports per-dependency status. A degraded backend stays ready
+// since policy management still works without the dashboards' data
+// sources; only an unavailable one returns 503.
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	report, err := h.healthService.Readiness(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	if report.Status == models.ReadinessUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
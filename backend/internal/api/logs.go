@@ -0,0 +1,264 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"waf-admin/internal/models"
+	"waf-admin/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLogFilters returns the hosts, status codes, methods and rule IDs
+// present in the logs with their counts. start and end default to the last
+// hour; limit caps the values per field.
+func (h *LogsHandler) GetLogFilters(c *gin.Context) {
+	timeRange, ok := parseTimeRange(c, time.Hour)
+	if !ok {
+		return
+	}
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = parsed
+	}
+
+	filters, err := h.logsService.GetLogFilters(c.Request.Context(), timeRange, limit)
+	if errors.Is(err, services.ErrInvalidLogQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to load log filters: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, filters)
+}
+
+// TailLogs streams new log entries as server-sent events until the client
+// disconnects. Entries are sent as "log" events; "dropped" events report
+// entries skipped because the client read too slowly, and an "error" event
+// ends the stream if VictoriaLogs fails. A comment line is sent as a
+// heartbeat so proxies keep idle streams open.
+func (h *LogsHandler) TailLogs(c *gin.Context) {
+	query, err := parseLogQueryParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tail, err := h.logsService.TailLogs(ctx, query)
+	switch {
+	case errors.Is(err, services.ErrTooManyTails):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidLogQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to start log tail: " + err.Error()})
+		return
+	}
+
+	cfg := h.logsService.TailConfig()
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Stop nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+
+	// Events are written to gin's buffer and sent on flush. A client that
+	// stops reading blocks the flush until the write deadline, which ends
+	// the stream.
+	controller := http.NewResponseController(c.Writer)
+	flush := func() bool {
+		controller.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		return controller.Flush() == nil && ctx.Err() == nil
+	}
+	if !flush() {
+		return
+	}
+
+	heartbeat := time.NewTicker(cfg.HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case entry, ok := <-tail.Entries:
+			if !ok {
+				if err := tail.Err(); err != nil {
+					c.SSEvent("error", gin.H{"error": err.Error()})
+					flush()
+				}
+				return
+			}
+			if n := tail.Dropped(); n > 0 {
+				c.SSEvent("dropped", gin.H{"count": n})
+			}
+			c.SSEvent("log", entry)
+			if !flush() {
+				return
+			}
+		case <-heartbeat.C:
+			if n := tail.Dropped(); n > 0 {
+				c.SSEvent("dropped", gin.H{"count": n})
+			}
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			if !flush() {
+				return
+			}
+		}
+	}
+}
+
+// parseLogQueryParams reads the typed log filters from query parameters.
+// host, status, method, client_ip and rule_id may be repeated; a status is
+// either a code or a range such as 400-499.
+func parseLogQueryParams(c *gin.Context) (models.LogQuery, error) {
+	query := models.LogQuery{
+		Query:      c.Query("query"),
+		Hosts:      c.QueryArray("host"),
+		Methods:    c.QueryArray("method"),
+		ClientIPs:  c.QueryArray("client_ip"),
+		RuleIDs:    c.QueryArray("rule_id"),
+		PathPrefix: c.Query("path_prefix"),
+		Text:       c.Query("text"),
+	}
+	if raw := c.Query("advanced"); raw != "" {
+		advanced, err := strconv.ParseBool(raw)
+		if err != nil {
+			return query, fmt.Errorf("advanced must be true or false")
+		}
+		query.Advanced = advanced
+	}
+	for _, raw := range c.QueryArray("status") {
+		min, max, isRange := strings.Cut(raw, "-")
+		r := models.StatusRange{}
+		var err error
+		if r.Min, err = strconv.Atoi(min); err != nil {
+			return query, fmt.Errorf("status must be a code or a range such as 400-499, got %q", raw)
+		}
+		if isRange {
+			if r.Max, err = strconv.Atoi(max); err != nil {
+				return query, fmt.Errorf("status must be a code or a range such as 400-499, got %q", raw)
+			}
+		}
+		query.Status = append(query.Status, r)
+	}
+	return query, nil
+}
+
+// GetWAFEvents returns parsed ModSecurity audit log records. start and end
+// default to the last hour; host, client_ip, rule_id and action filter the
+// events.
+func (h *LogsHandler) GetWAFEvents(c *gin.Context) {
+	timeRange, ok := parseTimeRange(c, time.Hour)
+	if !ok {
+		return
+	}
+	query := models.WAFEventQuery{
+		Host:      c.Query("host"),
+		ClientIP:  c.Query("client_ip"),
+		RuleID:    c.Query("rule_id"),
+		Action:    c.Query("action"),
+		TimeRange: timeRange,
+	}
+	var err error
+	if raw := c.Query("limit"); raw != "" {
+		if query.Limit, err = strconv.Atoi(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+			return
+		}
+	}
+	if raw := c.Query("offset"); raw != "" {
+		if query.Offset, err = strconv.Atoi(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a number"})
+			return
+		}
+	}
+
+	result, err := h.logsService.SearchWAFEvents(c.Request.Context(), query)
+	if errors.Is(err, services.ErrInvalidLogQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query WAF events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ExportLogs streams the entries matching a log query as a file download
+// in CSV, NDJSON or parquet, optionally gzipped. A failure after the
+// download has started cannot change the status, so the outcome is sent in
+// the X-Export-Rows and X-Export-Error trailers.
+func (h *LogsHandler) ExportLogs(c *gin.Context) {
+	var req models.LogExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	export, err := h.logsService.PrepareExport(req)
+	switch {
+	case errors.Is(err, services.ErrTooManyExports):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidLogQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start log export"})
+		return
+	}
+
+	c.Header("Content-Type", export.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.FileName()))
+	c.Header("Trailer", "X-Export-Rows")
+	c.Status(http.StatusOK)
+
+	w := &deadlineWriter{
+		w:          c.Writer,
+		controller: http.NewResponseController(c.Writer),
+		timeout:    h.logsService.ExportConfig().WriteTimeout,
+	}
+	rows, err := export.Write(c.Request.Context(), w)
+	c.Writer.Header().Set("X-Export-Rows", strconv.FormatInt(rows, 10))
+	if err != nil {
+		// The status was sent already; aborting the response is the only
+		// way to keep a truncated export from looking complete. The gzip
+		// or parquet footer is not written and the client sees the
+		// connection reset; the error is in the EXPORT_LOGS audit entry.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// deadlineWriter extends the write deadline before each write, so that a
+// client that stops reading ends a long download instead of blocking it
+type deadlineWriter struct {
+	w          io.Writer
+	controller *http.ResponseController
+	timeout    time.Duration
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	d.controller.SetWriteDeadline(time.Now().Add(d.timeout))
+	return d.w.Write(p)
+}
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"waf-admin/internal/models"
@@ -22,34 +24,89 @@ func NewMetricsHandler(metricsService *services.MetricsService) *MetricsHandler
 
 // GetMetricsSummary returns aggregated metrics
 func (h *MetricsHandler) GetMetricsSummary(c *gin.Context) {
-	// Parse time range from query parameters
-	startStr := c.DefaultQuery("start", time.Now().Add(-1*time.Hour).Format(time.RFC3339))
-	endStr := c.DefaultQuery("end", time.Now().Format(time.RFC3339))
+	timeRange, ok := parseTimeRange(c, time.Hour)
+	if !ok {
+		return
+	}
 
-	start, err := time.Parse(time.RFC3339, startStr)
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = parsed
+	}
+
+	summary, err := h.metricsService.GetMetricsSummary(c.Request.Context(), timeRange, c.Query("host"), limit)
+	if errors.Is(err, services.ErrInvalidSummaryQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start time format"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get metrics summary"})
 		return
 	}
 
-	end, err := time.Parse(time.RFC3339, endStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end time format"})
+	c.JSON(http.StatusOK, summary)
+}
+
+// GetTimeSeries returns per-host chart series for the time range
+func (h *MetricsHandler) GetTimeSeries(c *gin.Context) {
+	timeRange, ok := parseTimeRange(c, time.Hour)
+	if !ok {
+		return
+	}
+	if !timeRange.End.After(timeRange.Start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end must be after start"})
 		return
 	}
 
-	timeRange := models.TimeRange{
-		Start: start,
-		End:   end,
+	var step time.Duration
+	if raw := c.Query("step"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid step, expected a duration such as 30s or 5m"})
+			return
+		}
+		step = parsed
 	}
 
-	summary, err := h.metricsService.GetMetricsSummary(c.Request.Context(), timeRange)
+	result, err := h.metricsService.GetTimeSeries(c.Request.Context(), timeRange, c.Query("host"), step)
+	if errors.Is(err, services.ErrInvalidTimeSeriesQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get metrics summary"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get metrics time series"})
 		return
 	}
 
-	c.JSON(http.StatusOK, summary)
+	c.JSON(http.StatusOK, result)
+}
+
+// parseTimeRange reads RFC3339 start and end query parameters, defaulting to
+// the last defaultSpan. It writes a 400 response and returns false when
+// either is malformed.
+func parseTimeRange(c *gin.Context, defaultSpan time.Duration) (models.TimeRange, bool) {
+	now := time.Now()
+	startStr := c.DefaultQuery("start", now.Add(-defaultSpan).Format(time.RFC3339))
+	endStr := c.DefaultQuery("end", now.Format(time.RFC3339))
+
+	start, err := time.Parse(time.RFC3339, startStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start time format"})
+		return models.TimeRange{}, false
+	}
+
+	end, err := time.Parse(time.RFC3339, endStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end time format"})
+		return models.TimeRange{}, false
+	}
+
+	return models.TimeRange{Start: start, End: end}, true
 }
 
 type LogsHandler struct {
@@ -71,6 +128,10 @@ func (h *LogsHandler) SearchLogs(c *gin.Context) {
 	}
 
 	result, err := h.logsService.SearchLogs(c.Request.Context(), query)
+	if errors.Is(err, services.ErrInvalidLogQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search logs"})
 		return
@@ -78,9 +139,3 @@ func (h *LogsHandler) SearchLogs(c *gin.Context) {
 
 	c.JSON(http.StatusOK, result)
 }
-
-// GetLogFilters returns available log filters
-func (h *LogsHandler) GetLogFilters(c *gin.Context) {
-	filters := h.logsService.GetLogFilters()
-	c.JSON(http.StatusOK, filters)
-}
\ No newline at end of file
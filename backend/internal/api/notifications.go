@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+
+	"waf-admin/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationsHandler struct {
+	notifier *services.Notifier
+}
+
+func NewNotificationsHandler(notifier *services.Notifier) *NotificationsHandler {
+	return &NotificationsHandler{
+		notifier: notifier,
+	}
+}
+
+// GetDeadLetters returns the most recent notifications that could not be
+// delivered, newest first
+func (h *NotificationsHandler) GetDeadLetters(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"dead_letters": h.notifier.GetDeadLetters()})
+}
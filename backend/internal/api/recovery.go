@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Recovery answers 500 for a handler that panics, logging the panic.
+// http.ErrAbortHandler is raised again so that net/http aborts the
+// response: a handler streaming a download panics with it to show the
+// client that the body is incomplete, which gin.Recovery would turn into a
+// well-formed response.
+func Recovery(logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			logger.Errorf("Panic serving %s %s: %v\n%s", c.Request.Method, c.Request.URL.Path, err, debug.Stack())
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}()
+		c.Next()
+	}
+}
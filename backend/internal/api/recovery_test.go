@@ -0,0 +1,51 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	router := gin.New()
+	router.Use(Recovery(logger))
+	router.GET("/panic", func(c *gin.Context) { panic("boom") })
+	router.GET("/abort", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		c.Writer.WriteString("partial")
+		c.Writer.Flush()
+		panic(http.ErrAbortHandler)
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/panic")
+	if err != nil {
+		t.Fatalf("GET /panic: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("GET /panic status = %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+
+	resp, err = http.Get(server.URL + "/abort")
+	if err != nil {
+		t.Fatalf("GET /abort: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /abort status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	// The body must not end cleanly, so the client can tell it is truncated
+	if body, err := io.ReadAll(resp.Body); err == nil {
+		t.Errorf("GET /abort body %q ended without an error", body)
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"waf-admin/internal/models"
+	"waf-admin/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type SilencesHandler struct {
+	silencesService *services.SilencesService
+	logger          *logrus.Logger
+}
+
+func NewSilencesHandler(silencesService *services.SilencesService, logger *logrus.Logger) *SilencesHandler {
+	return &SilencesHandler{
+		silencesService: silencesService,
+		logger:          logger,
+	}
+}
+
+// ListSilences returns silences, optionally filtered by the state query
+// parameter
+func (h *SilencesHandler) ListSilences(c *gin.Context) {
+	state := c.Query("state")
+	if err := services.ValidateSilenceState(state); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	silences, err := h.silencesService.ListSilences(c.Request.Context(), state)
+	if err != nil {
+		h.logger.Errorf("Failed to list silences: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to list silences: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"silences": silences})
+}
+
+// CreateSilence mutes the alerts matching the request's matchers
+func (h *SilencesHandler) CreateSilence(c *gin.Context) {
+	var req models.SilenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	silence, err := h.silencesService.CreateSilence(c.Request.Context(), req)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Silence created successfully", "silence": silence})
+}
+
+// ExpireSilence ends a silence immediately
+func (h *SilencesHandler) ExpireSilence(c *gin.Context) {
+	if err := h.silencesService.ExpireSilence(c.Request.Context(), c.Param("id")); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Silence expired successfully"})
+}
+
+func (h *SilencesHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSilence):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSilenceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSilenceConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.logger.Errorf("Failed to update silences: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update silences"})
+	}
+}
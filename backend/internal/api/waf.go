@@ -1,8 +1,10 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 
+	"waf-admin/internal/auth"
 	"waf-admin/internal/models"
 	"waf-admin/internal/services"
 
@@ -43,6 +45,11 @@ func (h *WAFHandler) UpdateWAFMode(c *gin.Context) {
 	}
 
 	if err := h.wafService.UpdateWAFMode(c.Request.Context(), req); err != nil {
+		if errors.Is(err, auth.ErrForbidden) {
+			h.logger.Warnf("Failed to update WAF mode: %v", err)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		h.logger.Errorf("Failed to update WAF mode: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update WAF mode"})
 		return
@@ -60,6 +67,11 @@ func (h *WAFHandler) UpdateExceptions(c *gin.Context) {
 	}
 
 	if err := h.wafService.UpdateExceptions(c.Request.Context(), req); err != nil {
+		if errors.Is(err, auth.ErrForbidden) {
+			h.logger.Warnf("Failed to update exceptions: %v", err)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		h.logger.Errorf("Failed to update exceptions: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update exceptions"})
 		return
@@ -77,6 +89,11 @@ func (h *WAFHandler) UpdateRules(c *gin.Context) {
 	}
 
 	if err := h.wafService.UpdateRules(c.Request.Context(), req); err != nil {
+		if errors.Is(err, auth.ErrForbidden) {
+			h.logger.Warnf("Failed to update rules: %v", err)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		h.logger.Errorf("Failed to update rules: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rules"})
 		return
@@ -94,6 +111,11 @@ func (h *WAFHandler) ApplyConfiguration(c *gin.Context) {
 	}
 
 	if err := h.wafService.ApplyConfiguration(c.Request.Context(), req); err != nil {
+		if errors.Is(err, auth.ErrForbidden) {
+			h.logger.Warnf("Failed to apply configuration: %v", err)
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		h.logger.Errorf("Failed to apply configuration: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply configuration"})
 		return
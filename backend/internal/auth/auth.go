@@ -0,0 +1,358 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"waf-admin/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+const (
+	// RoleAdmin may read and change WAF configuration
+	RoleAdmin = "admin"
+	// RoleViewer may only read status, metrics, logs and audit entries
+	RoleViewer = "viewer"
+
+	MethodNone       = "none"
+	MethodBasic      = "basic"
+	MethodBearer     = "bearer"
+	MethodSession    = "session"
+	MethodKubernetes = "kubernetes"
+
+	userContextKey = "auth.user"
+	csrfHeader     = "X-CSRF-Token"
+)
+
+// User is the authenticated caller of a request
+type User struct {
+	Name   string              `json:"name"`
+	UID    string              `json:"uid,omitempty"`
+	Email  string              `json:"email,omitempty"`
+	Groups []string            `json:"groups,omitempty"`
+	Extra  map[string][]string `json:"-"`
+	Roles  []string            `json:"roles"`
+	Method string              `json:"method"`
+	// Delegated users are authorized per change by the Kubernetes API
+	// rather than by role
+	Delegated bool `json:"delegated,omitempty"`
+}
+
+// HasRole reports whether the user holds the role; admins hold every role
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role || r == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type ctxKey struct{}
+
+// WithUser returns a copy of ctx carrying the user
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, ctxKey{}, user)
+}
+
+// UserFromContext returns the user stored by the auth middleware, if any
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(ctxKey{}).(*User)
+	return user, ok
+}
+
+// CurrentUser returns the user attached to a gin request
+func CurrentUser(c *gin.Context) (*User, bool) {
+	if v, ok := c.Get(userContextKey); ok {
+		if user, ok := v.(*User); ok {
+			return user, true
+		}
+	}
+	return UserFromContext(c.Request.Context())
+}
+
+// Authenticator authenticates API requests using basic auth, bearer JWTs
+// issued by the configured OIDC provider, Kubernetes tokens, or session cookies
+type Authenticator struct {
+	logger   *logrus.Logger
+	reviewer KubernetesReviewer
+	state    atomic.Pointer[authState]
+}
+
+// authState is swapped as a whole when the configuration is reloaded so a
+// request never sees a mix of old and new settings
+type authState struct {
+	config     *config.Config
+	sessions   *SessionManager
+	oidc       *OIDCProvider
+	kubernetes *kubernetesAuthenticator
+}
+
+func NewAuthenticator(ctx context.Context, cfg *config.Config, logger *logrus.Logger) (*Authenticator, error) {
+	a := &Authenticator{
+		logger: logger,
+	}
+
+	state, err := a.newState(ctx, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	a.state.Store(state)
+
+	return a, nil
+}
+
+// UpdateConfig applies a reloaded configuration. Components whose settings
+// did not change are reused so sessions and cached reviews survive the reload;
+// on error the previous configuration stays active.
+func (a *Authenticator) UpdateConfig(ctx context.Context, cfg *config.Config) error {
+	state, err := a.newState(ctx, cfg, a.state.Load())
+	if err != nil {
+		return err
+	}
+	a.state.Store(state)
+	return nil
+}
+
+func (a *Authenticator) newState(ctx context.Context, cfg *config.Config, previous *authState) (*authState, error) {
+	state := &authState{config: cfg}
+
+	if previous != nil && sameSessionConfig(previous.config.Security, cfg.Security) {
+		state.sessions = previous.sessions
+	} else {
+		sessions, err := NewSessionManager(cfg, a.logger)
+		if err != nil {
+			return nil, err
+		}
+		// Sessions logged out before the reload stay revoked
+		if previous != nil {
+			sessions.revoked = previous.sessions.revoked
+		}
+		state.sessions = sessions
+	}
+
+	if cfg.Security.EnableAuth && cfg.Security.OIDC.Enabled {
+		if previous != nil && previous.oidc != nil && reflect.DeepEqual(previous.config.Security.OIDC, cfg.Security.OIDC) {
+			state.oidc = previous.oidc
+		} else {
+			provider, err := NewOIDCProvider(ctx, cfg, a.logger)
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize OIDC provider: %w", err)
+			}
+			state.oidc = provider
+		}
+	}
+
+	if a.reviewer != nil && cfg.Security.EnableAuth && cfg.Security.KubernetesAuth.Enabled {
+		if previous != nil && previous.kubernetes != nil && reflect.DeepEqual(previous.config.Security.KubernetesAuth, cfg.Security.KubernetesAuth) {
+			state.kubernetes = previous.kubernetes
+		} else {
+			state.kubernetes = newKubernetesAuthenticator(a.reviewer, cfg.Security.KubernetesAuth)
+			a.logger.Info("Kubernetes TokenReview authentication enabled")
+		}
+	}
+
+	return state, nil
+}
+
+func sameSessionConfig(a, b config.SecurityConfig) bool {
+	return a.SessionSecret == b.SessionSecret && a.SessionTTL == b.SessionTTL && a.CookieSecure == b.CookieSecure
+}
+
+// Sessions returns the session manager used for cookie sessions
+func (a *Authenticator) Sessions() *SessionManager {
+	return a.state.Load().sessions
+}
+
+// OIDC returns the OIDC provider, or nil when OIDC login is disabled
+func (a *Authenticator) OIDC() *OIDCProvider {
+	return a.state.Load().oidc
+}
+
+// Middleware authenticates the request and stores the user in the gin and
+// request contexts. Cookie sessions must present a matching CSRF token on
+// state-changing requests.
+func (a *Authenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state := a.state.Load()
+		if !state.config.Security.EnableAuth {
+			a.setUser(c, &User{Name: "anonymous", Roles: []string{RoleAdmin}, Method: MethodNone})
+			c.Next()
+			return
+		}
+
+		user, err := state.authenticate(c)
+		if err != nil {
+			a.logger.Debugf("Authentication failed: %v", err)
+			if state.config.Security.Password != "" {
+				c.Header("WWW-Authenticate", `Basic realm="Authorization Required"`)
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		if len(user.Roles) == 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "No role assigned to user"})
+			return
+		}
+
+		if user.Method == MethodSession && !isSafeMethod(c.Request.Method) {
+			if err := state.sessions.VerifyCSRF(c); err != nil {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Invalid CSRF token"})
+				return
+			}
+		}
+
+		a.setUser(c, user)
+		c.Next()
+	}
+}
+
+// RequireRole rejects requests whose user lacks the given role. Delegated
+// users hold no role beyond viewer, so they are rejected too; routes open
+// to them use RequireRoleOrAccess or RequireRoleOrDelegated.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok || !user.HasRole(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRoleOrAccess admits users with the given role, and delegated users
+// whose own RBAC allows the access returned by attrs, checked with a
+// SubjectAccessReview. attrs is called per request so that it follows
+// configuration reloads.
+func (a *Authenticator) RequireRoleOrAccess(role string, attrs func() authorizationv1.ResourceAttributes) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if ok && user.HasRole(role) {
+			c.Next()
+			return
+		}
+		if !ok || !user.Delegated {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+
+		err := a.AuthorizeKubernetes(c.Request.Context(), attrs())
+		if errors.Is(err, ErrForbidden) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			a.logger.Warnf("SubjectAccessReview failed: %v", err)
+			c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"error": "Failed to check access"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRoleOrDelegated admits users with the given role and delegated
+// users. It is only for routes whose service authorizes every change of a
+// delegated user with a SubjectAccessReview, as the WAF policy routes do.
+func RequireRoleOrDelegated(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok || !(user.HasRole(role) || user.Delegated) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func (s *authState) authenticate(c *gin.Context) (*User, error) {
+	header := c.GetHeader("Authorization")
+	switch {
+	case strings.HasPrefix(header, "Bearer "):
+		return s.authenticateBearer(c.Request.Context(), strings.TrimPrefix(header, "Bearer "))
+	case strings.HasPrefix(header, "Basic "):
+		return s.authenticateBasic(c)
+	}
+
+	if session, err := s.sessions.Load(c); err == nil {
+		return s.sessionUser(session)
+	}
+
+	return nil, fmt.Errorf("no credentials provided")
+}
+
+// sessionUser maps the session's groups to roles with the current
+// group_roles, so a role removed from the mapping or a login method that
+// was disabled takes effect without waiting for the session to expire
+func (s *authState) sessionUser(session *Session) (*User, error) {
+	if s.oidc == nil {
+		return nil, fmt.Errorf("OIDC login is disabled, session no longer accepted")
+	}
+	user := *session.User
+	user.Roles = s.oidc.mapRoles(user.Groups)
+	return &user, nil
+}
+
+// authenticateBearer tries the OIDC issuer first and falls back to a
+// Kubernetes TokenReview for tokens the issuer does not recognise
+func (s *authState) authenticateBearer(ctx context.Context, token string) (*User, error) {
+	if s.oidc == nil && s.kubernetes == nil {
+		return nil, fmt.Errorf("bearer tokens are not accepted")
+	}
+
+	var oidcErr error
+	if s.oidc != nil {
+		user, err := s.oidc.VerifyBearer(ctx, token)
+		if err == nil {
+			return user, nil
+		}
+		oidcErr = err
+	}
+
+	if s.kubernetes != nil {
+		user, err := s.kubernetes.authenticate(ctx, token)
+		if err != nil {
+			return nil, fmt.Errorf("token review failed: %w", err)
+		}
+		return user, nil
+	}
+	return nil, oidcErr
+}
+
+func (s *authState) authenticateBasic(c *gin.Context) (*User, error) {
+	username, password, ok := c.Request.BasicAuth()
+	if !ok || s.config.Security.Password == "" {
+		return nil, fmt.Errorf("basic auth is not configured")
+	}
+
+	userMatch := subtle.ConstantTimeCompare([]byte(username), []byte(s.config.Security.Username)) == 1
+	passMatch := subtle.ConstantTimeCompare([]byte(password), []byte(s.config.Security.Password)) == 1
+	if !userMatch || !passMatch {
+		return nil, fmt.Errorf("invalid credentials for user %q", username)
+	}
+
+	return &User{Name: username, Roles: []string{RoleAdmin}, Method: MethodBasic}, nil
+}
+
+func (a *Authenticator) setUser(c *gin.Context, user *User) {
+	c.Set(userContextKey, user)
+	c.Request = c.Request.WithContext(WithUser(c.Request.Context(), user))
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
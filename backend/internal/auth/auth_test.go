@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"waf-admin/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestAuthenticator(t *testing.T, cfg *config.Config) *Authenticator {
+	t.Helper()
+	authenticator, err := NewAuthenticator(context.Background(), cfg, testLogger())
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+	return authenticator
+}
+
+// sessionCookies returns the cookies of a new session for user
+func sessionCookies(t *testing.T, sessions *SessionManager, user *User) ([]*http.Cookie, *Session) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	session, err := sessions.Create(c, user)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return recorder.Result().Cookies(), session
+}
+
+// newSessionAuthenticator returns an authenticator with OIDC login against
+// a mock provider, and the cookies of a session for an admin
+func newSessionAuthenticator(t *testing.T) (*Authenticator, []*http.Cookie, *Session) {
+	t.Helper()
+	mock, err := NewMockProvider(testClientID, MockUser{Subject: "1234", Username: "alice"})
+	if err != nil {
+		t.Fatalf("NewMockProvider: %v", err)
+	}
+	t.Cleanup(mock.Close)
+
+	authenticator := newTestAuthenticator(t, testConfig(mock.Issuer()))
+	cookies, session := sessionCookies(t, authenticator.Sessions(), &User{
+		Name:   "alice",
+		Groups: []string{"waf-admins"},
+		Roles:  []string{RoleAdmin},
+		Method: MethodSession,
+	})
+	return authenticator, cookies, session
+}
+
+func newTestRouter(authenticator *Authenticator) *gin.Engine {
+	router := gin.New()
+	router.Use(authenticator.Middleware())
+	router.Any("/api/test", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.POST("/api/admin", RequireRole(RoleAdmin), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.POST("/api/logout", func(c *gin.Context) {
+		authenticator.Sessions().Clear(c)
+		c.Status(http.StatusNoContent)
+	})
+	return router
+}
+
+func serve(router *gin.Engine, method, path string, cookies []*http.Cookie, csrfToken string) int {
+	req := httptest.NewRequest(method, path, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	if csrfToken != "" {
+		req.Header.Set(csrfHeader, csrfToken)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func TestMiddlewareCSRF(t *testing.T) {
+	authenticator, cookies, session := newSessionAuthenticator(t)
+	router := newTestRouter(authenticator)
+
+	tests := []struct {
+		name    string
+		method  string
+		cookies bool
+		token   string
+		want    int
+	}{
+		{name: "GET without token", method: http.MethodGet, cookies: true, want: http.StatusNoContent},
+		{name: "POST without token", method: http.MethodPost, cookies: true, want: http.StatusForbidden},
+		{name: "POST with wrong token", method: http.MethodPost, cookies: true, token: "forged", want: http.StatusForbidden},
+		{name: "DELETE with wrong token", method: http.MethodDelete, cookies: true, token: "forged", want: http.StatusForbidden},
+		{name: "POST with token", method: http.MethodPost, cookies: true, token: session.CSRFToken, want: http.StatusNoContent},
+		{name: "POST without session", method: http.MethodPost, token: session.CSRFToken, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestCookies []*http.Cookie
+			if tt.cookies {
+				requestCookies = cookies
+			}
+			if code := serve(router, tt.method, "/api/test", requestCookies, tt.token); code != tt.want {
+				t.Errorf("%s status = %d, want %d", tt.method, code, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareBasicAuthSkipsCSRF(t *testing.T) {
+	cfg := &config.Config{Security: config.SecurityConfig{
+		EnableAuth:    true,
+		Username:      "admin",
+		Password:      "secret",
+		SessionSecret: "test-secret",
+		SessionTTL:    time.Hour,
+	}}
+	authenticator := newTestAuthenticator(t, cfg)
+
+	router := gin.New()
+	router.Use(authenticator.Middleware())
+	router.POST("/api/test", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	req := httptest.NewRequest(http.MethodPost, "/api/test", nil)
+	req.SetBasicAuth("admin", "secret")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusNoContent)
+	}
+}
+
+func TestSessionRevokedOnLogout(t *testing.T) {
+	authenticator, cookies, session := newSessionAuthenticator(t)
+	router := newTestRouter(authenticator)
+
+	if code := serve(router, http.MethodGet, "/api/test", cookies, ""); code != http.StatusNoContent {
+		t.Fatalf("before logout status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := serve(router, http.MethodPost, "/api/logout", cookies, session.CSRFToken); code != http.StatusNoContent {
+		t.Fatalf("logout status = %d, want %d", code, http.StatusNoContent)
+	}
+	// A copy of the cookie kept by the browser or an attacker is rejected
+	if code := serve(router, http.MethodGet, "/api/test", cookies, ""); code != http.StatusUnauthorized {
+		t.Errorf("after logout status = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	// and stays rejected when a reload replaces the session manager
+	cfg := *authenticator.state.Load().config
+	cfg.Security.SessionTTL = 2 * time.Hour
+	if err := authenticator.UpdateConfig(context.Background(), &cfg); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	if code := serve(router, http.MethodGet, "/api/test", cookies, ""); code != http.StatusUnauthorized {
+		t.Errorf("after reload status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestSessionRolesFollowGroupRoles(t *testing.T) {
+	authenticator, cookies, session := newSessionAuthenticator(t)
+	router := newTestRouter(authenticator)
+
+	if code := serve(router, http.MethodPost, "/api/admin", cookies, session.CSRFToken); code != http.StatusNoContent {
+		t.Fatalf("admin status = %d, want %d", code, http.StatusNoContent)
+	}
+
+	// Demote the group; the admin role stored in the cookie is ignored
+	cfg := *authenticator.state.Load().config
+	cfg.Security.OIDC.GroupRoles = map[string]string{"waf-admins": RoleViewer}
+	if err := authenticator.UpdateConfig(context.Background(), &cfg); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	if code := serve(router, http.MethodPost, "/api/admin", cookies, session.CSRFToken); code != http.StatusForbidden {
+		t.Errorf("demoted status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	// Removing every role rejects the session
+	unmapped := cfg
+	unmapped.Security.OIDC.GroupRoles = map[string]string{}
+	if err := authenticator.UpdateConfig(context.Background(), &unmapped); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	if code := serve(router, http.MethodGet, "/api/test", cookies, ""); code != http.StatusForbidden {
+		t.Errorf("unmapped status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	// Disabling OIDC login ends the session
+	disabled := unmapped
+	disabled.Security.OIDC.Enabled = false
+	if err := authenticator.UpdateConfig(context.Background(), &disabled); err != nil {
+		t.Fatalf("UpdateConfig: %v", err)
+	}
+	if code := serve(router, http.MethodGet, "/api/test", cookies, ""); code != http.StatusUnauthorized {
+		t.Errorf("OIDC disabled status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"waf-admin/internal/config"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+// ErrForbidden is returned when the caller's own RBAC denies a change
+var ErrForbidden = errors.New("forbidden")
+
+// KubernetesReviewer validates tokens and checks access against the
+// Kubernetes API; it is implemented by k8s.Client
+type KubernetesReviewer interface {
+	ReviewToken(ctx context.Context, token string, audiences []string) (*authenticationv1.UserInfo, error)
+	CheckAccess(ctx context.Context, user authenticationv1.UserInfo, attrs authorizationv1.ResourceAttributes) (bool, string, error)
+}
+
+type cachedReview struct {
+	user      authenticationv1.UserInfo
+	expiresAt time.Time
+}
+
+// kubernetesAuthenticator authenticates callers with their own Kubernetes
+// tokens. Successful reviews are cached briefly by token hash so that every
+// request does not trigger a TokenReview.
+type kubernetesAuthenticator struct {
+	reviewer  KubernetesReviewer
+	audiences []string
+	ttl       time.Duration
+	cache     map[string]cachedReview
+	mutex     sync.Mutex
+}
+
+func newKubernetesAuthenticator(reviewer KubernetesReviewer, cfg config.KubernetesAuthConfig) *kubernetesAuthenticator {
+	ttl := cfg.CacheTTL
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	return &kubernetesAuthenticator{
+		reviewer:  reviewer,
+		audiences: cfg.Audiences,
+		ttl:       ttl,
+		cache:     make(map[string]cachedReview),
+	}
+}
+
+func (k *kubernetesAuthenticator) authenticate(ctx context.Context, token string) (*User, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	now := time.Now()
+
+	k.mutex.Lock()
+	cached, ok := k.cache[key]
+	k.mutex.Unlock()
+
+	info := cached.user
+	if !ok || now.After(cached.expiresAt) {
+		reviewed, err := k.reviewer.ReviewToken(ctx, token, k.audiences)
+		if err != nil {
+			return nil, err
+		}
+		info = *reviewed
+
+		k.mutex.Lock()
+		for key, entry := range k.cache {
+			if now.After(entry.expiresAt) {
+				delete(k.cache, key)
+			}
+		}
+		k.cache[key] = cachedReview{user: info, expiresAt: now.Add(k.ttl)}
+		k.mutex.Unlock()
+	}
+
+	extra := make(map[string][]string, len(info.Extra))
+	for name, values := range info.Extra {
+		extra[name] = values
+	}
+
+	// Kubernetes users can read through the admin, but every change is
+	// authorized against their own RBAC with a SubjectAccessReview
+	return &User{
+		Name:      info.Username,
+		UID:       info.UID,
+		Groups:    info.Groups,
+		Extra:     extra,
+		Roles:     []string{RoleViewer},
+		Method:    MethodKubernetes,
+		Delegated: true,
+	}, nil
+}
+
+func (k *kubernetesAuthenticator) authorize(ctx context.Context, user *User, attrs authorizationv1.ResourceAttributes) error {
+	extra := make(map[string]authenticationv1.ExtraValue, len(user.Extra))
+	for name, values := range user.Extra {
+		extra[name] = authenticationv1.ExtraValue(values)
+	}
+
+	allowed, reason, err := k.reviewer.CheckAccess(ctx, authenticationv1.UserInfo{
+		Username: user.Name,
+		UID:      user.UID,
+		Groups:   user.Groups,
+		Extra:    extra,
+	}, attrs)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		if reason == "" {
+			reason = "access denied by RBAC"
+		}
+		return fmt.Errorf("%w: user %s cannot %s %s in namespace %s: %s",
+			ErrForbidden, user.Name, attrs.Verb, attrs.Resource, attrs.Namespace, reason)
+	}
+	return nil
+}
+
+// SetKubernetesReviewer enables Kubernetes token authentication when
+// security.kubernetes_auth.enabled is set
+func (a *Authenticator) SetKubernetesReviewer(reviewer KubernetesReviewer) {
+	a.reviewer = reviewer
+
+	current := a.state.Load()
+	cfg := current.config.Security
+	if !cfg.EnableAuth || !cfg.KubernetesAuth.Enabled {
+		return
+	}
+
+	state := *current
+	state.kubernetes = newKubernetesAuthenticator(reviewer, cfg.KubernetesAuth)
+	a.state.Store(&state)
+	a.logger.Info("Kubernetes TokenReview authentication enabled")
+}
+
+// AuthorizeIngressChange checks that the caller may apply the given verb to
+// Ingresses in the namespace. Only Kubernetes-authenticated callers are
+// checked; other users are authorized by role.
+func (a *Authenticator) AuthorizeIngressChange(ctx context.Context, namespace, verb string) error {
+	return a.AuthorizeKubernetes(ctx, authorizationv1.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      verb,
+		Group:     "networking.k8s.io",
+		Resource:  "ingresses",
+	})
+}
+
+// ConfigMapAccess returns the attributes for verb on the ConfigMap named by
+// ref, for use with RequireRoleOrAccess
+func ConfigMapAccess(verb string, ref func() (namespace, name string)) func() authorizationv1.ResourceAttributes {
+	return func() authorizationv1.ResourceAttributes {
+		namespace, name := ref()
+		return authorizationv1.ResourceAttributes{
+			Namespace: namespace,
+			Verb:      verb,
+			Resource:  "configmaps",
+			Name:      name,
+		}
+	}
+}
+
+// AuthorizeKubernetes checks the caller's own RBAC for attrs with a
+// SubjectAccessReview. Only Kubernetes-authenticated callers are checked;
+// other users are authorized by role.
+func (a *Authenticator) AuthorizeKubernetes(ctx context.Context, attrs authorizationv1.ResourceAttributes) error {
+	user, ok := UserFromContext(ctx)
+	if !ok || user.Method != MethodKubernetes {
+		return nil
+	}
+	kubernetes := a.state.Load().kubernetes
+	if kubernetes == nil {
+		return fmt.Errorf("%w: kubernetes authentication is disabled", ErrForbidden)
+	}
+	return kubernetes.authorize(ctx, user, attrs)
+}
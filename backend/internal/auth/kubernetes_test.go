@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"waf-admin/internal/config"
+
+	"github.com/gin-gonic/gin"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+// fakeReviewer accepts the tokens in users and allows the verbs in allowed
+type fakeReviewer struct {
+	users     map[string]authenticationv1.UserInfo
+	allowed   map[string]bool
+	reviewErr error
+	accessErr error
+
+	mutex    sync.Mutex
+	reviews  int
+	accesses []authorizationv1.ResourceAttributes
+}
+
+func (f *fakeReviewer) ReviewToken(ctx context.Context, token string, audiences []string) (*authenticationv1.UserInfo, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.reviews++
+	if f.reviewErr != nil {
+		return nil, f.reviewErr
+	}
+	user, ok := f.users[token]
+	if !ok {
+		return nil, errors.New("token not authenticated")
+	}
+	return &user, nil
+}
+
+func (f *fakeReviewer) CheckAccess(ctx context.Context, user authenticationv1.UserInfo, attrs authorizationv1.ResourceAttributes) (bool, string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.accesses = append(f.accesses, attrs)
+	if f.accessErr != nil {
+		return false, "", f.accessErr
+	}
+	if !f.allowed[attrs.Verb] {
+		return false, "no RBAC policy matched", nil
+	}
+	return true, "", nil
+}
+
+func (f *fakeReviewer) reviewCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.reviews
+}
+
+func TestKubernetesTokenReviewCache(t *testing.T) {
+	reviewer := &fakeReviewer{users: map[string]authenticationv1.UserInfo{
+		"token-a": {Username: "alice", UID: "1", Groups: []string{"dev"}},
+		"token-b": {Username: "bob", UID: "2"},
+	}}
+	k := newKubernetesAuthenticator(reviewer, config.KubernetesAuthConfig{CacheTTL: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	user, err := k.authenticate(ctx, "token-a")
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if user.Name != "alice" || user.Method != MethodKubernetes || !user.Delegated || user.HasRole(RoleAdmin) {
+		t.Errorf("user = %+v", user)
+	}
+	if _, err := k.authenticate(ctx, "token-a"); err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if n := reviewer.reviewCount(); n != 1 {
+		t.Errorf("reviews after cached call = %d, want 1", n)
+	}
+
+	if user, err := k.authenticate(ctx, "token-b"); err != nil || user.Name != "bob" {
+		t.Fatalf("authenticate token-b = %+v, %v", user, err)
+	}
+	if n := reviewer.reviewCount(); n != 2 {
+		t.Errorf("reviews after second token = %d, want 2", n)
+	}
+
+	// Rejected tokens are not cached
+	for i := 0; i < 2; i++ {
+		if _, err := k.authenticate(ctx, "unknown"); err == nil {
+			t.Fatal("authenticate unknown token succeeded")
+		}
+	}
+	if n := reviewer.reviewCount(); n != 4 {
+		t.Errorf("reviews after rejected tokens = %d, want 4", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := k.authenticate(ctx, "token-a"); err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if n := reviewer.reviewCount(); n != 5 {
+		t.Errorf("reviews after expiry = %d, want 5", n)
+	}
+}
+
+func TestKubernetesAuthorization(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		basic     bool
+		noToken   bool
+		allowed   map[string]bool
+		accessErr error
+		reviewErr error
+		want      int
+		wantSARs  int
+	}{
+		{name: "access allowed", path: "/access", allowed: map[string]bool{"update": true}, want: http.StatusNoContent, wantSARs: 1},
+		{name: "access denied", path: "/access", allowed: map[string]bool{"get": true}, want: http.StatusForbidden, wantSARs: 1},
+		{name: "access review error", path: "/access", accessErr: errors.New("connection refused"), want: http.StatusBadGateway, wantSARs: 1},
+		{name: "access as admin", path: "/access", basic: true, want: http.StatusNoContent},
+		{name: "delegated route", path: "/delegated", want: http.StatusNoContent},
+		{name: "delegated route as admin", path: "/delegated", basic: true, want: http.StatusNoContent},
+		{name: "admin route", path: "/admin", allowed: map[string]bool{"update": true}, want: http.StatusForbidden},
+		{name: "admin route as admin", path: "/admin", basic: true, want: http.StatusNoContent},
+		{name: "read", path: "/read", want: http.StatusNoContent},
+		{name: "unknown token", path: "/read", noToken: true, want: http.StatusUnauthorized},
+		{name: "token review error", path: "/read", reviewErr: errors.New("connection refused"), want: http.StatusUnauthorized},
+		{name: "service denies change", path: "/service", allowed: map[string]bool{"get": true}, want: http.StatusForbidden, wantSARs: 1},
+		{name: "service allows change", path: "/service", allowed: map[string]bool{"create": true}, want: http.StatusNoContent, wantSARs: 1},
+		{name: "service skips role users", path: "/service", basic: true, want: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reviewer := &fakeReviewer{
+				users:     map[string]authenticationv1.UserInfo{"k8s-token": {Username: "alice", UID: "1"}},
+				allowed:   tt.allowed,
+				accessErr: tt.accessErr,
+				reviewErr: tt.reviewErr,
+			}
+			cfg := &config.Config{Security: config.SecurityConfig{
+				EnableAuth:     true,
+				Username:       "admin",
+				Password:       "secret",
+				SessionSecret:  "test-secret",
+				SessionTTL:     time.Hour,
+				KubernetesAuth: config.KubernetesAuthConfig{Enabled: true},
+			}}
+			authenticator := newTestAuthenticator(t, cfg)
+			authenticator.SetKubernetesReviewer(reviewer)
+
+			access := ConfigMapAccess("update", func() (string, string) { return "monitoring", "waf-alert-rules" })
+			ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+			router := gin.New()
+			router.Use(authenticator.Middleware())
+			router.GET("/read", RequireRole(RoleViewer), ok)
+			router.POST("/admin", RequireRole(RoleAdmin), ok)
+			router.POST("/access", authenticator.RequireRoleOrAccess(RoleAdmin, access), ok)
+			router.POST("/delegated", RequireRoleOrDelegated(RoleAdmin), ok)
+			// A service behind RequireRoleOrDelegated checks each change itself
+			router.POST("/service", RequireRoleOrDelegated(RoleAdmin), func(c *gin.Context) {
+				err := authenticator.AuthorizeIngressChange(c.Request.Context(), "default", "create")
+				if errors.Is(err, ErrForbidden) {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+					return
+				}
+				if err != nil {
+					c.AbortWithStatus(http.StatusInternalServerError)
+					return
+				}
+				c.Status(http.StatusNoContent)
+			})
+
+			method := http.MethodPost
+			if tt.path == "/read" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			switch {
+			case tt.basic:
+				req.SetBasicAuth("admin", "secret")
+			case tt.noToken:
+				req.Header.Set("Authorization", "Bearer unknown")
+			default:
+				req.Header.Set("Authorization", "Bearer k8s-token")
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", recorder.Code, tt.want, recorder.Body.String())
+			}
+			if len(reviewer.accesses) != tt.wantSARs {
+				t.Errorf("SubjectAccessReviews = %d, want %d", len(reviewer.accesses), tt.wantSARs)
+			}
+			if tt.path == "/access" && tt.wantSARs == 1 {
+				attrs := reviewer.accesses[0]
+				if attrs.Namespace != "monitoring" || attrs.Name != "waf-alert-rules" || attrs.Resource != "configmaps" || attrs.Verb != "update" {
+					t.Errorf("SubjectAccessReview attributes = %+v", attrs)
+				}
+			}
+		})
+	}
+}
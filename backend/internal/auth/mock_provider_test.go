@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+// MockUser is the identity the mock provider logs in
+type MockUser struct {
+	Subject  string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// mockCode is what an issued authorization code was requested with
+type mockCode struct {
+	nonce     string
+	challenge string
+}
+
+// MockProvider is a minimal OIDC provider for tests. Its authorize endpoint
+// approves every request for the configured user; the token endpoint checks
+// the PKCE verifier against the S256 challenge sent to authorize.
+type MockProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	keyID    string
+	signer   jose.Signer
+	clientID string
+	user     MockUser
+	codes    map[string]mockCode
+	mutex    sync.Mutex
+}
+
+// NewMockProvider starts a mock OIDC provider on a random local port
+func NewMockProvider(clientID string, user MockUser) (*MockProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	p := &MockProvider{
+		key:      key,
+		keyID:    "mock-key",
+		clientID: clientID,
+		user:     user,
+		codes:    make(map[string]mockCode),
+	}
+
+	p.signer, err = jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: p.keyID}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signer: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("/keys", p.handleKeys)
+	mux.HandleFunc("/authorize", p.handleAuthorize)
+	mux.HandleFunc("/token", p.handleToken)
+	p.server = httptest.NewServer(mux)
+
+	return p, nil
+}
+
+// Issuer returns the issuer URL to use as security.oidc.issuer_url
+func (p *MockProvider) Issuer() string {
+	return p.server.URL
+}
+
+// Close shuts down the provider
+func (p *MockProvider) Close() {
+	p.server.Close()
+}
+
+// IssueToken signs a token for the mock user with the given audience and
+// extra claims, suitable for use as a bearer token
+func (p *MockProvider) IssueToken(audience string, extra map[string]interface{}) (string, error) {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":                p.Issuer(),
+		"sub":                p.user.Subject,
+		"aud":                audience,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"preferred_username": p.user.Username,
+		"email":              p.user.Email,
+		"groups":             p.user.Groups,
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return jwt.Signed(p.signer).Claims(claims).CompactSerialize()
+}
+
+func (p *MockProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.Issuer() + "/authorize",
+		"token_endpoint":                        p.Issuer() + "/token",
+		"jwks_uri":                              p.Issuer() + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (p *MockProvider) handleKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &p.key.PublicKey,
+		KeyID:     p.keyID,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+}
+
+func (p *MockProvider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectURI.String() == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomToken()
+	p.mutex.Lock()
+	p.codes[code] = mockCode{nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	p.mutex.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *MockProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mutex.Lock()
+	issued, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mutex.Unlock()
+	if !ok || s256(r.PostForm.Get("code_verifier")) != issued.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := p.IssueToken(p.clientID, map[string]interface{}{"nonce": issued.nonce})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	accessToken, err := p.IssueToken(p.clientID, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"waf-admin/internal/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+const (
+	loginStateCookieName = "waf_oidc_state"
+	loginStateTTL        = 10 * time.Minute
+)
+
+// loginState is kept in a signed cookie between the login redirect and the callback
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	ReturnTo string `json:"return_to"`
+}
+
+// OIDCProvider implements the authorization-code login flow and validates
+// bearer JWTs against the issuer's JWKS. Signing keys are cached by the
+// remote key set and refetched when a token references an unknown key ID.
+type OIDCProvider struct {
+	config        config.OIDCConfig
+	logger        *logrus.Logger
+	provider      *oidc.Provider
+	oauth2        oauth2.Config
+	idVerifier    *oidc.IDTokenVerifier
+	tokenVerifier *oidc.IDTokenVerifier
+	audiences     []string
+}
+
+func NewOIDCProvider(ctx context.Context, cfg *config.Config, logger *logrus.Logger) (*OIDCProvider, error) {
+	oidcCfg := cfg.Security.OIDC
+
+	provider, err := oidc.NewProvider(ctx, oidcCfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover issuer %s: %w", oidcCfg.IssuerURL, err)
+	}
+
+	audiences := oidcCfg.Audiences
+	if len(audiences) == 0 {
+		audiences = []string{oidcCfg.ClientID}
+	}
+
+	scopes := oidcCfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID}
+	}
+
+	logger.Infof("OIDC authentication enabled with issuer %s", oidcCfg.IssuerURL)
+
+	return &OIDCProvider{
+		config:   oidcCfg,
+		logger:   logger,
+		provider: provider,
+		oauth2: oauth2.Config{
+			ClientID:     oidcCfg.ClientID,
+			ClientSecret: oidcCfg.ClientSecret,
+			RedirectURL:  oidcCfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		idVerifier: provider.Verifier(&oidc.Config{ClientID: oidcCfg.ClientID}),
+		// Access tokens may carry an API audience rather than the client ID,
+		// so the audience is checked against the configured list instead
+		tokenVerifier: provider.Verifier(&oidc.Config{SkipClientIDCheck: true}),
+		audiences:     audiences,
+	}, nil
+}
+
+// StartLogin stores the login state cookie and returns the provider's authorization URL
+func (p *OIDCProvider) StartLogin(c *gin.Context, sessions *SessionManager, returnTo string) (string, error) {
+	state := loginState{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: oauth2.GenerateVerifier(),
+		ReturnTo: sanitizeReturnTo(returnTo),
+	}
+
+	if err := sessions.SetSigned(c, loginStateCookieName, state, loginStateTTL); err != nil {
+		return "", err
+	}
+
+	return p.oauth2.AuthCodeURL(state.State,
+		oidc.Nonce(state.Nonce),
+		oauth2.S256ChallengeOption(state.Verifier),
+	), nil
+}
+
+// FinishLogin validates the callback, exchanges the code and returns the
+// logged-in user together with the path to redirect to
+func (p *OIDCProvider) FinishLogin(c *gin.Context, sessions *SessionManager) (*User, string, error) {
+	var state loginState
+	if err := sessions.LoadSigned(c, loginStateCookieName, &state); err != nil {
+		return nil, "", fmt.Errorf("missing or invalid login state: %w", err)
+	}
+	sessions.ClearCookie(c, loginStateCookieName)
+
+	if errCode := c.Query("error"); errCode != "" {
+		return nil, "", fmt.Errorf("provider returned error %s: %s", errCode, c.Query("error_description"))
+	}
+	if c.Query("state") != state.State {
+		return nil, "", fmt.Errorf("state mismatch")
+	}
+
+	ctx := c.Request.Context()
+	token, err := p.oauth2.Exchange(ctx, c.Query("code"), oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, "", fmt.Errorf("token response has no id_token")
+	}
+
+	idToken, err := p.idVerifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to verify id_token: %w", err)
+	}
+	if idToken.Nonce != state.Nonce {
+		return nil, "", fmt.Errorf("nonce mismatch")
+	}
+
+	user, err := p.userFromToken(idToken, MethodSession)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, state.ReturnTo, nil
+}
+
+// VerifyBearer validates a bearer JWT's signature, issuer, expiry and audience
+func (p *OIDCProvider) VerifyBearer(ctx context.Context, rawToken string) (*User, error) {
+	token, err := p.tokenVerifier.Verify(ctx, rawToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify bearer token: %w", err)
+	}
+
+	if !p.audienceAllowed(token.Audience) {
+		return nil, fmt.Errorf("bearer token audience %v not accepted", token.Audience)
+	}
+
+	return p.userFromToken(token, MethodBearer)
+}
+
+func (p *OIDCProvider) audienceAllowed(tokenAudiences []string) bool {
+	for _, aud := range tokenAudiences {
+		for _, allowed := range p.audiences {
+			if aud == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *OIDCProvider) userFromToken(token *oidc.IDToken, method string) (*User, error) {
+	var claims map[string]interface{}
+	if err := token.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode claims: %w", err)
+	}
+
+	user := &User{
+		Name:   stringClaim(claims, p.config.UsernameClaim),
+		Email:  stringClaim(claims, "email"),
+		Groups: stringSliceClaim(claims, p.config.GroupsClaim),
+		Method: method,
+	}
+	if user.Name == "" {
+		user.Name = user.Email
+	}
+	if user.Name == "" {
+		user.Name = token.Subject
+	}
+
+	user.Roles = p.mapRoles(user.Groups)
+	return user, nil
+}
+
+// mapRoles translates provider groups into admin roles using group_roles,
+// falling back to default_role when no group matches
+func (p *OIDCProvider) mapRoles(groups []string) []string {
+	seen := make(map[string]bool)
+	for _, group := range groups {
+		if role, ok := p.config.GroupRoles[group]; ok && role != "" {
+			seen[role] = true
+		}
+	}
+	if len(seen) == 0 && p.config.DefaultRole != "" {
+		seen[p.config.DefaultRole] = true
+	}
+
+	roles := make([]string, 0, len(seen))
+	for role := range seen {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	if name == "" {
+		return ""
+	}
+	if v, ok := claims[name].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func stringSliceClaim(claims map[string]interface{}, name string) []string {
+	switch v := claims[name].(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case string:
+		return strings.Fields(v)
+	}
+	return nil
+}
+
+// sanitizeReturnTo only allows local absolute paths to prevent open redirects
+func sanitizeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return "/"
+	}
+	return returnTo
+}
@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"waf-admin/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const testClientID = "waf-admin"
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func testConfig(issuer string) *config.Config {
+	return &config.Config{Security: config.SecurityConfig{
+		EnableAuth:    true,
+		SessionSecret: "test-secret",
+		SessionTTL:    time.Hour,
+		OIDC: config.OIDCConfig{
+			Enabled:       true,
+			IssuerURL:     issuer,
+			ClientID:      testClientID,
+			RedirectURL:   "https://waf.local/api/auth/callback",
+			Scopes:        []string{"openid"},
+			UsernameClaim: "preferred_username",
+			GroupsClaim:   "groups",
+			GroupRoles:    map[string]string{"waf-admins": RoleAdmin, "waf-viewers": RoleViewer},
+		},
+	}}
+}
+
+func newTestProvider(t *testing.T) (*MockProvider, *OIDCProvider, *SessionManager) {
+	t.Helper()
+	mock, err := NewMockProvider(testClientID, MockUser{
+		Subject:  "1234",
+		Username: "alice",
+		Email:    "alice@example.com",
+		Groups:   []string{"waf-admins"},
+	})
+	if err != nil {
+		t.Fatalf("NewMockProvider: %v", err)
+	}
+	t.Cleanup(mock.Close)
+
+	cfg := testConfig(mock.Issuer())
+	provider, err := NewOIDCProvider(context.Background(), cfg, testLogger())
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	sessions, err := NewSessionManager(cfg, testLogger())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	return mock, provider, sessions
+}
+
+// startLogin runs StartLogin and follows the authorization URL to the mock
+// provider, returning the login state and the callback query it redirected to
+func startLogin(t *testing.T, provider *OIDCProvider, sessions *SessionManager) (loginState, url.Values) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/auth/login", nil)
+
+	authURL, err := provider.StartLogin(c, sessions, "/dashboard")
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+
+	var state loginState
+	load, _ := gin.CreateTestContext(httptest.NewRecorder())
+	load.Request = httptest.NewRequest(http.MethodGet, "/api/auth/callback", nil)
+	for _, cookie := range recorder.Result().Cookies() {
+		load.Request.AddCookie(cookie)
+	}
+	if err := sessions.LoadSigned(load, loginStateCookieName, &state); err != nil {
+		t.Fatalf("login state cookie: %v", err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize redirect: %v", err)
+	}
+	return state, location.Query()
+}
+
+// finishLogin calls FinishLogin with the login state signed into the
+// cookie and the given callback query
+func finishLogin(provider *OIDCProvider, sessions *SessionManager, state loginState, query url.Values) (*User, string, error) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	if err := sessions.SetSigned(c, loginStateCookieName, state, loginStateTTL); err != nil {
+		return nil, "", err
+	}
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/auth/callback?"+query.Encode(), nil)
+	for _, cookie := range recorder.Result().Cookies() {
+		c.Request.AddCookie(cookie)
+	}
+	return provider.FinishLogin(c, sessions)
+}
+
+func TestLoginCallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(state *loginState, query url.Values)
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			mutate: func(*loginState, url.Values) {},
+		},
+		{
+			name:    "state mismatch",
+			mutate:  func(_ *loginState, query url.Values) { query.Set("state", "forged") },
+			wantErr: "state mismatch",
+		},
+		{
+			name:    "nonce mismatch",
+			mutate:  func(state *loginState, _ url.Values) { state.Nonce = "other" },
+			wantErr: "nonce mismatch",
+		},
+		{
+			name:    "wrong PKCE verifier",
+			mutate:  func(state *loginState, _ url.Values) { state.Verifier = "wrong-verifier-wrong-verifier-wrong-verifier" },
+			wantErr: "failed to exchange code",
+		},
+		{
+			name:    "provider error",
+			mutate:  func(_ *loginState, query url.Values) { query.Set("error", "access_denied") },
+			wantErr: "provider returned error access_denied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, provider, sessions := newTestProvider(t)
+			state, query := startLogin(t, provider, sessions)
+			if query.Get("state") != state.State {
+				t.Fatalf("provider returned state %q, want %q", query.Get("state"), state.State)
+			}
+			tt.mutate(&state, query)
+
+			user, returnTo, err := finishLogin(provider, sessions, state, query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("FinishLogin error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FinishLogin: %v", err)
+			}
+			if user.Name != "alice" || user.Method != MethodSession || !reflect.DeepEqual(user.Roles, []string{RoleAdmin}) {
+				t.Errorf("user = %+v", user)
+			}
+			if returnTo != "/dashboard" {
+				t.Errorf("returnTo = %q, want /dashboard", returnTo)
+			}
+		})
+	}
+}
+
+func TestFinishLoginWithoutStateCookie(t *testing.T) {
+	_, provider, sessions := newTestProvider(t)
+	_, query := startLogin(t, provider, sessions)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/auth/callback?"+query.Encode(), nil)
+	if _, _, err := provider.FinishLogin(c, sessions); err == nil || !strings.Contains(err.Error(), "login state") {
+		t.Fatalf("FinishLogin error = %v, want missing login state", err)
+	}
+}
+
+func TestVerifyBearer(t *testing.T) {
+	mock, provider, _ := newTestProvider(t)
+	other, err := NewMockProvider(testClientID, MockUser{Subject: "1234", Username: "alice"})
+	if err != nil {
+		t.Fatalf("NewMockProvider: %v", err)
+	}
+	defer other.Close()
+
+	tests := []struct {
+		name    string
+		issue   func() (string, error)
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			issue: func() (string, error) { return mock.IssueToken(testClientID, nil) },
+		},
+		{
+			name:    "wrong audience",
+			issue:   func() (string, error) { return mock.IssueToken("another-app", nil) },
+			wantErr: "audience",
+		},
+		{
+			name: "wrong issuer claim",
+			issue: func() (string, error) {
+				return mock.IssueToken(testClientID, map[string]interface{}{"iss": "https://evil.example.com"})
+			},
+			wantErr: "issued by a different provider",
+		},
+		{
+			name: "signed by another issuer",
+			issue: func() (string, error) {
+				return other.IssueToken(testClientID, map[string]interface{}{"iss": mock.Issuer()})
+			},
+			wantErr: "failed to verify bearer token",
+		},
+		{
+			name: "expired",
+			issue: func() (string, error) {
+				return mock.IssueToken(testClientID, map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})
+			},
+			wantErr: "expired",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.issue()
+			if err != nil {
+				t.Fatalf("IssueToken: %v", err)
+			}
+			user, err := provider.VerifyBearer(context.Background(), token)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("VerifyBearer error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyBearer: %v", err)
+			}
+			if user.Name != "alice" || user.Method != MethodBearer {
+				t.Errorf("user = %+v", user)
+			}
+		})
+	}
+}
+
+func TestMapRoles(t *testing.T) {
+	tests := []struct {
+		name        string
+		groups      []string
+		defaultRole string
+		want        []string
+	}{
+		{name: "admin group", groups: []string{"waf-admins"}, want: []string{RoleAdmin}},
+		{name: "both groups", groups: []string{"waf-viewers", "waf-admins", "other"}, want: []string{RoleAdmin, RoleViewer}},
+		{name: "unmapped group", groups: []string{"other"}, want: []string{}},
+		{name: "default role", groups: []string{"other"}, defaultRole: RoleViewer, want: []string{RoleViewer}},
+		{name: "default role not added to mapped", groups: []string{"waf-admins"}, defaultRole: RoleViewer, want: []string{RoleAdmin}},
+		{name: "no groups", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig("").Security.OIDC
+			cfg.DefaultRole = tt.defaultRole
+			provider := &OIDCProvider{config: cfg}
+			if got := provider.mapRoles(tt.groups); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mapRoles(%v) = %v, want %v", tt.groups, got, tt.want)
+			}
+		})
+	}
+}
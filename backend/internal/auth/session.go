@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"waf-admin/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	sessionCookieName = "waf_session"
+	csrfCookieName    = "waf_csrf"
+	cookiePath        = "/api"
+	// The CSRF cookie must be readable by the frontend, which is served
+	// from /, so that it can echo it back
+	csrfCookiePath = "/"
+)
+
+// Session is the state carried in the signed session cookie. The user's
+// roles are not trusted from the cookie; they are mapped again from the
+// groups on every request, see authState.authenticate.
+type Session struct {
+	ID        string    `json:"id"`
+	User      *User     `json:"user"`
+	CSRFToken string    `json:"csrf"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// SessionManager issues and validates HMAC-signed cookies. Sessions
+// survive restarts as long as the secret is configured; sessions ended by
+// logout are remembered in memory until they would have expired.
+type SessionManager struct {
+	secret  []byte
+	ttl     time.Duration
+	secure  bool
+	revoked *revocationList
+}
+
+// revocationList holds the IDs of logged-out sessions with their expiry.
+// It is shared by the session managers created on configuration reloads.
+type revocationList struct {
+	sessions map[string]time.Time
+	mutex    sync.Mutex
+}
+
+func (r *revocationList) revoke(id string, expiresAt time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	for revokedID, expiry := range r.sessions {
+		if now.After(expiry) {
+			delete(r.sessions, revokedID)
+		}
+	}
+	r.sessions[id] = expiresAt
+}
+
+func (r *revocationList) isRevoked(id string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, revoked := r.sessions[id]
+	return revoked
+}
+
+func NewSessionManager(cfg *config.Config, logger *logrus.Logger) (*SessionManager, error) {
+	secret := []byte(cfg.Security.SessionSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate session secret: %w", err)
+		}
+		logger.Warn("security.session_secret is not set, sessions will not survive a restart")
+	}
+
+	ttl := cfg.Security.SessionTTL
+	if ttl <= 0 {
+		ttl = 8 * time.Hour
+	}
+
+	return &SessionManager{
+		secret: secret,
+		ttl:    ttl,
+		secure: cfg.Security.CookieSecure,
+		revoked: &revocationList{
+			sessions: make(map[string]time.Time),
+		},
+	}, nil
+}
+
+// Create starts a session for the user and sets the session and CSRF cookies
+func (m *SessionManager) Create(c *gin.Context, user *User) (*Session, error) {
+	session := &Session{
+		ID:        randomToken(),
+		User:      user,
+		CSRFToken: randomToken(),
+		ExpiresAt: time.Now().Add(m.ttl),
+	}
+
+	if err := m.SetSigned(c, sessionCookieName, session, m.ttl); err != nil {
+		return nil, err
+	}
+
+	// The CSRF cookie is readable by the frontend, which echoes it back in
+	// the X-CSRF-Token header (double-submit, bound to the signed session)
+	m.setCookie(c, csrfCookieName, session.CSRFToken, csrfCookiePath, m.ttl, false)
+	return session, nil
+}
+
+// Load returns the session from the request cookie
+func (m *SessionManager) Load(c *gin.Context) (*Session, error) {
+	var session Session
+	if err := m.LoadSigned(c, sessionCookieName, &session); err != nil {
+		return nil, err
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, fmt.Errorf("session expired")
+	}
+	if session.User == nil {
+		return nil, fmt.Errorf("session has no user")
+	}
+	if session.ID == "" || m.revoked.isRevoked(session.ID) {
+		return nil, fmt.Errorf("session has been logged out")
+	}
+	return &session, nil
+}
+
+// Clear revokes the request's session, so that a copy of its cookie is no
+// longer accepted, and removes the session and CSRF cookies
+func (m *SessionManager) Clear(c *gin.Context) {
+	if session, err := m.Load(c); err == nil {
+		m.revoked.revoke(session.ID, session.ExpiresAt)
+	}
+	m.setCookie(c, sessionCookieName, "", cookiePath, -1, true)
+	m.setCookie(c, csrfCookieName, "", csrfCookiePath, -1, false)
+}
+
+// VerifyCSRF checks the X-CSRF-Token header against the session token
+func (m *SessionManager) VerifyCSRF(c *gin.Context) error {
+	session, err := m.Load(c)
+	if err != nil {
+		return err
+	}
+	token := c.GetHeader(csrfHeader)
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) != 1 {
+		return fmt.Errorf("csrf token mismatch")
+	}
+	return nil
+}
+
+// SetSigned stores value as a signed, HttpOnly cookie
+func (m *SessionManager) SetSigned(c *gin.Context, name string, value interface{}, ttl time.Duration) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cookie %s: %w", name, err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	m.setCookie(c, name, encoded+"."+m.sign(encoded), cookiePath, ttl, true)
+	return nil
+}
+
+// LoadSigned verifies a cookie written by SetSigned and decodes it into out
+func (m *SessionManager) LoadSigned(c *gin.Context, name string, out interface{}) error {
+	raw, err := c.Cookie(name)
+	if err != nil {
+		return err
+	}
+
+	encoded, signature, ok := strings.Cut(raw, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(m.sign(encoded))) {
+		return fmt.Errorf("invalid signature on cookie %s", name)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("failed to decode cookie %s: %w", name, err)
+	}
+	return json.Unmarshal(payload, out)
+}
+
+// ClearCookie expires the named cookie
+func (m *SessionManager) ClearCookie(c *gin.Context, name string) {
+	m.setCookie(c, name, "", cookiePath, -1, true)
+}
+
+func (m *SessionManager) sign(value string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (m *SessionManager) setCookie(c *gin.Context, name, value, path string, ttl time.Duration, httpOnly bool) {
+	maxAge := int(ttl.Seconds())
+	if ttl < 0 {
+		maxAge = -1
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		Secure:   m.secure,
+		HttpOnly: httpOnly,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	hits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "waf_admin_cache_hits_total",
+		Help: "Lookups answered from the cache or by joining an in-flight load.",
+	}, []string{"cache"})
+	misses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "waf_admin_cache_misses_total",
+		Help: "Lookups that had to load the value from the backend.",
+	}, []string{"cache"})
+)
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// Cache is an in-process TTL cache. Concurrent lookups of a missing key are
+// de-duplicated so only one of them loads the value; failed loads are not
+// cached. A TTL of zero disables caching but keeps the de-duplication.
+type Cache[V any] struct {
+	name       string
+	ttl        atomic.Int64
+	maxEntries int
+
+	mutex   sync.Mutex
+	entries map[string]entry[V]
+	group   singleflight.Group
+}
+
+func New[V any](name string, ttl time.Duration, maxEntries int) *Cache[V] {
+	c := &Cache[V]{
+		name:       name,
+		maxEntries: maxEntries,
+		entries:    make(map[string]entry[V]),
+	}
+	c.SetTTL(ttl)
+	return c
+}
+
+// SetTTL changes the lifetime of entries stored from now on
+func (c *Cache[V]) SetTTL(ttl time.Duration) {
+	c.ttl.Store(int64(ttl))
+}
+
+// Get returns the cached value for key, calling load when it is missing or
+// expired
+func (c *Cache[V]) Get(key string, load func() (V, error)) (V, error) {
+	now := time.Now()
+
+	c.mutex.Lock()
+	e, ok := c.entries[key]
+	c.mutex.Unlock()
+	if ok && now.Before(e.expiresAt) {
+		hits.WithLabelValues(c.name).Inc()
+		return e.value, nil
+	}
+
+	loaded := false
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		loaded = true
+		value, err := load()
+		if err != nil {
+			return value, err
+		}
+		if ttl := time.Duration(c.ttl.Load()); ttl > 0 {
+			c.store(key, entry[V]{value: value, expiresAt: time.Now().Add(ttl)})
+		}
+		return value, nil
+	})
+	if loaded {
+		misses.WithLabelValues(c.name).Inc()
+	} else {
+		hits.WithLabelValues(c.name).Inc()
+	}
+
+	value, _ := v.(V)
+	return value, err
+}
+
+func (c *Cache[V]) store(key string, e entry[V]) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		now := time.Now()
+		var oldestKey string
+		var oldest time.Time
+		for k, existing := range c.entries {
+			if now.After(existing.expiresAt) {
+				delete(c.entries, k)
+				continue
+			}
+			if oldestKey == "" || existing.expiresAt.Before(oldest) {
+				oldestKey, oldest = k, existing.expiresAt
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			delete(c.entries, oldestKey)
+		}
+	}
+	c.entries[key] = e
+}
@@ -0,0 +1,203 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"waf-admin/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+// Reloader serves the configured certificate and client CA bundle and
+// reloads them when the files change, e.g. when cert-manager rotates a
+// Secret mounted into the pod
+type Reloader struct {
+	config config.TLSConfig
+	logger *logrus.Logger
+
+	mutex     sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	contents  []byte
+}
+
+func NewReloader(cfg config.TLSConfig, logger *logrus.Logger) (*Reloader, error) {
+	r := &Reloader{
+		config: cfg,
+		logger: logger,
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns a server TLS configuration that always uses the most
+// recently loaded certificate and client CAs
+func (r *Reloader) TLSConfig() (*tls.Config, error) {
+	minVersion, ok := tlsVersions[r.config.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS min_version %q", r.config.MinVersion)
+	}
+
+	cipherSuites, err := parseCipherSuites(r.config.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	clientAuth := tls.NoClientCert
+	if r.config.ClientCAFile != "" {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	if r.config.ClientAuth != "" {
+		clientAuth, ok = clientAuthTypes[r.config.ClientAuth]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS client_auth %q", r.config.ClientAuth)
+		}
+	}
+
+	base := &tls.Config{
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+		ClientAuth:   clientAuth,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	base.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+		return r.cert, nil
+	}
+
+	// Client CAs cannot be supplied per handshake like certificates, so each
+	// connection gets a clone of the base config with the current pool
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientCAs = r.clientCAs
+		return cfg, nil
+	}
+
+	return base, nil
+}
+
+// Watch polls the certificate files until ctx is cancelled and reloads them
+// when their contents change. Polling is used instead of inotify because
+// Kubernetes updates mounted Secrets by swapping symlinks.
+func (r *Reloader) Watch(ctx context.Context) {
+	interval := r.config.ReloadInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.reload()
+			if err != nil {
+				r.logger.Errorf("Failed to reload TLS certificate, keeping the previous one: %v", err)
+			} else if changed {
+				r.logger.Infof("Reloaded TLS certificate from %s", r.config.CertFile)
+			}
+		}
+	}
+}
+
+func (r *Reloader) reload() (bool, error) {
+	certPEM, err := os.ReadFile(r.config.CertFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read cert_file: %w", err)
+	}
+	keyPEM, err := os.ReadFile(r.config.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read key_file: %w", err)
+	}
+	var caPEM []byte
+	if r.config.ClientCAFile != "" {
+		caPEM, err = os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("failed to read client_ca_file: %w", err)
+		}
+	}
+
+	contents := bytes.Join([][]byte{certPEM, keyPEM, caPEM}, nil)
+	r.mutex.RLock()
+	unchanged := bytes.Equal(contents, r.contents)
+	r.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse certificate key pair: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if caPEM != nil {
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return false, fmt.Errorf("no certificates found in client_ca_file %s", r.config.ClientCAFile)
+		}
+	}
+
+	r.mutex.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.contents = contents
+	r.mutex.Unlock()
+
+	return true, nil
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure TLS cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
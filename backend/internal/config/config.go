@@ -1,24 +1,53 @@
 package config
 
 import (
+	"encoding/json"
 	"log"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server     ServerConfig   `mapstructure:"server"`
-	Kubernetes K8sConfig      `mapstructure:"kubernetes"`
-	Metrics    MetricsConfig  `mapstructure:"metrics"`
-	Logs       LogsConfig     `mapstructure:"logs"`
-	Security   SecurityConfig `mapstructure:"security"`
+	Server        ServerConfig        `mapstructure:"server"`
+	Kubernetes    K8sConfig           `mapstructure:"kubernetes"`
+	Metrics       MetricsConfig       `mapstructure:"metrics"`
+	Logs          LogsConfig          `mapstructure:"logs"`
+	Security      SecurityConfig      `mapstructure:"security"`
+	Cache         CacheConfig         `mapstructure:"cache"`
+	Health        HealthConfig        `mapstructure:"health"`
+	Notifications NotificationsConfig `mapstructure:"notifications"`
 }
 
 type ServerConfig struct {
-	Port         int      `mapstructure:"port"`
-	Host         string   `mapstructure:"host"`
-	Mode         string   `mapstructure:"mode"`
-	AllowOrigins []string `mapstructure:"allow_origins"`
+	Port         int        `mapstructure:"port"`
+	Host         string     `mapstructure:"host"`
+	Mode         string     `mapstructure:"mode"`
+	AllowOrigins []string   `mapstructure:"allow_origins"`
+	CORS         CORSConfig `mapstructure:"cors"`
+	TLS          TLSConfig  `mapstructure:"tls"`
+}
+
+// CORSConfig configures cross-origin requests for the origins in allow_origins
+type CORSConfig struct {
+	AllowHeaders     []string      `mapstructure:"allow_headers"`
+	ExposeHeaders    []string      `mapstructure:"expose_headers"`
+	AllowCredentials bool          `mapstructure:"allow_credentials"`
+	MaxAge           time.Duration `mapstructure:"max_age"`
+}
+
+// TLSConfig configures HTTPS serving and optional client certificate verification
+type TLSConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	CertFile       string        `mapstructure:"cert_file"`
+	KeyFile        string        `mapstructure:"key_file"`
+	ClientCAFile   string        `mapstructure:"client_ca_file"`
+	ClientAuth     string        `mapstructure:"client_auth"`
+	MinVersion     string        `mapstructure:"min_version"`
+	CipherSuites   []string      `mapstructure:"cipher_suites"`
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
 }
 
 type K8sConfig struct {
@@ -32,36 +61,213 @@ type K8sConfig struct {
     DefaultIngressNamespace string `mapstructure:"default_ingress_namespace"`
     DefaultBackendServices []string `mapstructure:"default_backend_services"`
     DefaultApplyStrategy string `mapstructure:"default_apply_strategy"`
+	// DriftCheckInterval is how often applied policies are compared with
+	// the Ingresses and controller ConfigMap; 0 disables the check
+	DriftCheckInterval time.Duration `mapstructure:"drift_check_interval"`
 }
 
+// MetricsConfig locates VictoriaMetrics and vmalert. AlertmanagerURL is
+// optional; when set, silences are managed in Alertmanager instead of locally.
 type MetricsConfig struct {
-	VictoriaMetricsURL string `mapstructure:"victoria_metrics_url"`
-	VmalertURL         string `mapstructure:"vmalert_url"`
+	VictoriaMetricsURL string           `mapstructure:"victoria_metrics_url"`
+	VmalertURL         string           `mapstructure:"vmalert_url"`
+	AlertmanagerURL    string           `mapstructure:"alertmanager_url"`
+	WAFEvents          WAFEventsConfig  `mapstructure:"waf_events"`
+	AlertRules         AlertRulesConfig `mapstructure:"alert_rules"`
+	Silences           SilencesConfig   `mapstructure:"silences"`
+}
+
+// SilencesConfig locates the ConfigMap, in kubernetes.namespace, that holds
+// the silences applied locally when no Alertmanager is configured
+type SilencesConfig struct {
+	ConfigMapName string `mapstructure:"configmap_name"`
+}
+
+// AlertRulesConfig locates the ConfigMap holding the alert rules managed
+// through the API. vmalert mounts it as a rule file, so it must live in a
+// namespace vmalert can mount from.
+type AlertRulesConfig struct {
+	ConfigMapName string `mapstructure:"configmap_name"`
+	// Namespace defaults to kubernetes.namespace
+	Namespace string `mapstructure:"namespace"`
+	// Group is the vmalert rule group the managed rules are written to
+	Group string `mapstructure:"group"`
+}
+
+// WAFEventsConfig configures the exporter that turns ModSecurity log messages
+// from VictoriaLogs into waf_blocked_total and waf_detected_total counters
+type WAFEventsConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// Lag delays each poll window to allow for log ingestion delay
+	Lag time.Duration `mapstructure:"lag"`
 }
 
 type LogsConfig struct {
 	VictoriaLogsURL string `mapstructure:"victoria_logs_url"`
+	// ModSecurityFilter is the LogsQL filter selecting ModSecurity messages
+	// in the ingress controller logs
+	ModSecurityFilter string `mapstructure:"modsecurity_filter"`
+	// AuditLogFilter is the LogsQL filter selecting ModSecurity audit log
+	// records, which must arrive as the message of a log entry
+	AuditLogFilter string          `mapstructure:"audit_log_filter"`
+	Tail           LogTailConfig   `mapstructure:"tail"`
+	Export         LogExportConfig `mapstructure:"export"`
+}
+
+// LogExportConfig limits log exports. Each export is fetched in
+// ChunkDuration slices of its time range, so that VictoriaLogs sorts one
+// slice at a time.
+type LogExportConfig struct {
+	MaxConcurrent int           `mapstructure:"max_concurrent"`
+	ChunkDuration time.Duration `mapstructure:"chunk_duration"`
+	// WriteTimeout ends exports whose client stops reading
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+}
+
+// LogTailConfig limits live log tails. BufferSize is the number of entries
+// held per connection for a slow client before newer ones are dropped.
+type LogTailConfig struct {
+	MaxConcurrent     int           `mapstructure:"max_concurrent"`
+	BufferSize        int           `mapstructure:"buffer_size"`
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+	// WriteTimeout disconnects clients that stop reading
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+}
+
+// CacheConfig configures the in-process cache for metrics and log filter
+// responses; a TTL of zero disables it
+type CacheConfig struct {
+	TTL        time.Duration `mapstructure:"ttl"`
+	MaxEntries int           `mapstructure:"max_entries"`
+}
+
+// HealthConfig configures the dependency probes behind /readyz
+type HealthConfig struct {
+	// CacheTTL is how long a readiness result is reused, so frequent probes
+	// do not hit every dependency each time
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// NotificationsConfig configures webhook notifications. Failed deliveries
+// are retried with exponential backoff from RetryBackoff up to
+// MaxRetryBackoff, then written to the dead-letter log.
+type NotificationsConfig struct {
+	Channels        []NotificationChannel `mapstructure:"channels"`
+	QueueSize       int                   `mapstructure:"queue_size"`
+	Timeout         time.Duration         `mapstructure:"timeout"`
+	MaxRetries      int                   `mapstructure:"max_retries"`
+	RetryBackoff    time.Duration         `mapstructure:"retry_backoff"`
+	MaxRetryBackoff time.Duration         `mapstructure:"max_retry_backoff"`
+	// AlertPollInterval is how often firing alerts are checked for new
+	// ones to notify about; zero disables alert notifications
+	AlertPollInterval time.Duration `mapstructure:"alert_poll_interval"`
+	// DeadLetterFile optionally receives undeliverable notifications as
+	// JSON lines, in addition to the log
+	DeadLetterFile string `mapstructure:"dead_letter_file"`
+}
+
+// NotificationChannel is one webhook receiver. Events lists the event types
+// it is sent; empty means all. Template, a Go text/template executed with
+// the event, replaces the default payload for the channel type. When
+// Secret is set, requests carry an HMAC-SHA256 signature.
+type NotificationChannel struct {
+	Name       string   `mapstructure:"name"`
+	Type       string   `mapstructure:"type"`
+	URL        string   `mapstructure:"url"`
+	Events     []string `mapstructure:"events"`
+	Template   string   `mapstructure:"template"`
+	Secret     string   `mapstructure:"secret"`
+	SecretFile string   `mapstructure:"secret_file"`
+}
+
+// NotificationTemplateFuncs are available in channel templates; json
+// encodes a value so it can be embedded in a JSON payload
+var NotificationTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
 }
 
 type SecurityConfig struct {
-	EnableAuth bool   `mapstructure:"enable_auth"`
-	Username   string `mapstructure:"username"`
-	Password   string `mapstructure:"password"`
+	EnableAuth        bool                 `mapstructure:"enable_auth"`
+	Username          string               `mapstructure:"username"`
+	Password          string               `mapstructure:"password"`
+	PasswordFile      string               `mapstructure:"password_file"`
+	SessionSecret     string               `mapstructure:"session_secret"`
+	SessionSecretFile string               `mapstructure:"session_secret_file"`
+	SessionTTL        time.Duration        `mapstructure:"session_ttl"`
+	CookieSecure      bool                 `mapstructure:"cookie_secure"`
+	SecretRef         SecretRefConfig      `mapstructure:"secret_ref"`
+	OIDC              OIDCConfig           `mapstructure:"oidc"`
+	KubernetesAuth    KubernetesAuthConfig `mapstructure:"kubernetes_auth"`
+}
+
+// SecretRefConfig names a Kubernetes Secret that supplies any credentials
+// not set inline or through a *_file setting
+type SecretRefConfig struct {
+	Name                string `mapstructure:"name"`
+	Namespace           string `mapstructure:"namespace"`
+	PasswordKey         string `mapstructure:"password_key"`
+	SessionSecretKey    string `mapstructure:"session_secret_key"`
+	OIDCClientSecretKey string `mapstructure:"oidc_client_secret_key"`
+}
+
+// OIDCConfig configures OpenID Connect login and bearer JWT validation
+type OIDCConfig struct {
+	Enabled          bool              `mapstructure:"enabled"`
+	IssuerURL        string            `mapstructure:"issuer_url"`
+	ClientID         string            `mapstructure:"client_id"`
+	ClientSecret     string            `mapstructure:"client_secret"`
+	ClientSecretFile string            `mapstructure:"client_secret_file"`
+	RedirectURL      string            `mapstructure:"redirect_url"`
+	Scopes           []string          `mapstructure:"scopes"`
+	Audiences        []string          `mapstructure:"audiences"`
+	UsernameClaim    string            `mapstructure:"username_claim"`
+	GroupsClaim      string            `mapstructure:"groups_claim"`
+	GroupRoles       map[string]string `mapstructure:"group_roles"`
+	DefaultRole      string            `mapstructure:"default_role"`
+}
+
+// KubernetesAuthConfig configures authentication with callers' own Kubernetes
+// tokens (TokenReview) and per-mutation SubjectAccessReview checks
+type KubernetesAuthConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Audiences []string      `mapstructure:"audiences"`
+	CacheTTL  time.Duration `mapstructure:"cache_ttl"`
 }
 
 var GlobalConfig *Config
 
+var configFile string
+
+// SetConfigFile makes LoadConfig read the given file instead of searching
+// the default config paths
+func SetConfigFile(path string) {
+	configFile = path
+}
+
 func LoadConfig() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
 	viper.AddConfigPath("./config")
 	viper.AddConfigPath("/etc/waf-admin/")
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	}
 
 	viper.SetDefault("server.port", 8080)
 	viper.SetDefault("server.host", "0.0.0.0")
 	viper.SetDefault("server.mode", "release")
     viper.SetDefault("server.allow_origins", []string{"*"})
+	viper.SetDefault("server.cors.allow_headers", []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "Accept", "Origin", "Cache-Control", "X-Requested-With"})
+	viper.SetDefault("server.cors.allow_credentials", true)
+	viper.SetDefault("server.cors.max_age", "10m")
+	viper.SetDefault("server.tls.min_version", "1.2")
+	viper.SetDefault("server.tls.reload_interval", "1m")
     viper.SetDefault("kubernetes.namespace", "monitoring")
     viper.SetDefault("kubernetes.ingress_controller_namespace", "ingress-nginx")
     viper.SetDefault("kubernetes.ingress_controller_configmap_name", "ingress-nginx-controller")
@@ -70,13 +276,58 @@ func LoadConfig() (*Config, error) {
     viper.SetDefault("kubernetes.default_ingress_namespace", "default")
     viper.SetDefault("kubernetes.default_backend_services", []string{"echo-server", "ingress-nginx-defaultbackend"})
     viper.SetDefault("kubernetes.default_apply_strategy", "annotation")
+	viper.SetDefault("kubernetes.drift_check_interval", "5m")
 	viper.SetDefault("metrics.victoria_metrics_url", "http://victoria-metrics:8428")
 	viper.SetDefault("metrics.vmalert_url", "http://vmalert:8880")
+	viper.SetDefault("metrics.waf_events.enabled", true)
+	viper.SetDefault("metrics.waf_events.poll_interval", "30s")
+	viper.SetDefault("metrics.waf_events.lag", "30s")
+	viper.SetDefault("metrics.alert_rules.configmap_name", "waf-alert-rules")
+	viper.SetDefault("metrics.alert_rules.group", "waf-admin")
+	viper.SetDefault("metrics.silences.configmap_name", "waf-silences")
 	viper.SetDefault("logs.victoria_logs_url", "http://victoria-logs:9428")
+	viper.SetDefault("logs.modsecurity_filter", `"ModSecurity:"`)
+	viper.SetDefault("logs.audit_log_filter", `"unique_id" AND ("transaction" OR _msg:~"^-{2,3}[A-Za-z0-9]+-{1,3}A--")`)
+	viper.SetDefault("logs.tail.max_concurrent", 10)
+	viper.SetDefault("logs.tail.buffer_size", 256)
+	viper.SetDefault("logs.tail.heartbeat_interval", "15s")
+	viper.SetDefault("logs.tail.write_timeout", "10s")
+	viper.SetDefault("logs.export.max_concurrent", 2)
+	viper.SetDefault("logs.export.chunk_duration", "1h")
+	viper.SetDefault("logs.export.write_timeout", "30s")
+	viper.SetDefault("cache.ttl", "30s")
+	viper.SetDefault("cache.max_entries", 1000)
+	viper.SetDefault("health.cache_ttl", "5s")
+	viper.SetDefault("health.timeout", "2s")
+	viper.SetDefault("notifications.queue_size", 256)
+	viper.SetDefault("notifications.timeout", "10s")
+	viper.SetDefault("notifications.max_retries", 5)
+	viper.SetDefault("notifications.retry_backoff", "1s")
+	viper.SetDefault("notifications.max_retry_backoff", "1m")
+	viper.SetDefault("notifications.alert_poll_interval", "30s")
 	viper.SetDefault("security.enable_auth", true)
+	viper.SetDefault("security.session_ttl", "8h")
+	viper.SetDefault("security.cookie_secure", true)
+	viper.SetDefault("security.oidc.scopes", []string{"openid", "profile", "email", "groups"})
+	viper.SetDefault("security.oidc.username_claim", "preferred_username")
+	viper.SetDefault("security.oidc.groups_claim", "groups")
+	viper.SetDefault("security.kubernetes_auth.cache_ttl", "1m")
+	viper.SetDefault("security.secret_ref.password_key", "password")
+	viper.SetDefault("security.secret_ref.session_secret_key", "session_secret")
+	viper.SetDefault("security.secret_ref.oidc_client_secret_key", "oidc_client_secret")
 
-	viper.AutomaticEnv()
+	// Every setting can be overridden by WAF_ plus its upper-cased path with
+	// dots replaced by underscores, e.g. WAF_SECURITY_PASSWORD. The prefix must
+	// be set before AutomaticEnv, and keys are bound explicitly because
+	// Unmarshal only consults the environment for keys viper already knows.
 	viper.SetEnvPrefix("WAF")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+	for _, key := range EnvKeys() {
+		if err := viper.BindEnv(key); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -85,12 +336,28 @@ func LoadConfig() (*Config, error) {
 		log.Println("Config file not found, using defaults and environment variables")
 	}
 
+	config, err := decode()
+	if err != nil {
+		return nil, err
+	}
+
+	GlobalConfig = config
+	return config, nil
+}
+
+// decode unmarshals the current viper settings, reads secrets from their
+// *_file settings and validates the result
+func decode() (*Config, error) {
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, err
 	}
-
-	GlobalConfig = &config
+	if err := config.resolveSecretFiles(); err != nil {
+		return nil, err
+	}
+	if err := validateLoaded(&config); err != nil {
+		return nil, err
+	}
 	return &config, nil
 }
 
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted returns a copy of the configuration with secrets masked, safe to
+// log or write to the audit trail
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.Security.Password = mask(c.Security.Password)
+	redacted.Security.SessionSecret = mask(c.Security.SessionSecret)
+	redacted.Security.OIDC.ClientSecret = mask(c.Security.OIDC.ClientSecret)
+	redacted.Notifications.Channels = make([]NotificationChannel, len(c.Notifications.Channels))
+	for i, ch := range c.Notifications.Channels {
+		ch.Secret = mask(ch.Secret)
+		ch.URL = maskURLPath(ch.URL)
+		redacted.Notifications.Channels[i] = ch
+	}
+	return &redacted
+}
+
+// maskURLPath hides the path and query of a webhook URL, which for Slack
+// and Teams is the credential
+func maskURLPath(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return mask(raw)
+	}
+	if u.Path == "" && u.RawQuery == "" {
+		return raw
+	}
+	return u.Scheme + "://" + u.Host + "/******"
+}
+
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "******"
+}
+
+// EffectiveYAML renders the redacted configuration, after defaults and
+// environment overrides, using the same keys as config.yaml
+func (c *Config) EffectiveYAML() ([]byte, error) {
+	return yaml.Marshal(toMap(reflect.ValueOf(*c.Redacted())))
+}
+
+// toMap converts a config struct into nested maps keyed by mapstructure tag
+// so durations are written as "10m" rather than nanoseconds
+func toMap(v reflect.Value) interface{} {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		out := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			name := v.Type().Field(i).Tag.Get("mapstructure")
+			if name == "" {
+				continue
+			}
+			out[name] = toMap(v.Field(i))
+		}
+		return out
+	case reflect.Slice:
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = toMap(v.Index(i))
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[iter.Key().String()] = toMap(iter.Value())
+		}
+		return out
+	}
+	return v.Interface()
+}
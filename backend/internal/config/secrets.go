@@ -0,0 +1,123 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SecretReader fetches the data of a Kubernetes Secret; it is implemented by
+// k8s.Client
+type SecretReader interface {
+	GetSecretData(ctx context.Context, namespace, name string) (map[string][]byte, error)
+}
+
+// secretField ties a credential to its *_file setting and its key in the
+// referenced Kubernetes Secret
+type secretField struct {
+	path   string
+	value  *string
+	file   string
+	keyRef string
+}
+
+func (c *Config) secretFields() []secretField {
+	sec := &c.Security
+	fields := []secretField{
+		{"security.password", &sec.Password, sec.PasswordFile, sec.SecretRef.PasswordKey},
+		{"security.session_secret", &sec.SessionSecret, sec.SessionSecretFile, sec.SecretRef.SessionSecretKey},
+		{"security.oidc.client_secret", &sec.OIDC.ClientSecret, sec.OIDC.ClientSecretFile, sec.SecretRef.OIDCClientSecretKey},
+	}
+	// Webhook signing secrets can only come from files, not secret_ref
+	for i := range c.Notifications.Channels {
+		ch := &c.Notifications.Channels[i]
+		fields = append(fields, secretField{fmt.Sprintf("notifications.channels[%d].secret", i), &ch.Secret, ch.SecretFile, ""})
+	}
+	return fields
+}
+
+// resolveSecretFiles fills empty credentials from their *_file settings, such
+// as a Secret mounted into the pod. Inline values and environment overrides
+// take precedence over files.
+func (c *Config) resolveSecretFiles() error {
+	var errs ValidationErrors
+	for _, field := range c.secretFields() {
+		if *field.value != "" || field.file == "" {
+			continue
+		}
+		data, err := os.ReadFile(field.file)
+		if err != nil {
+			errs.add(field.path+"_file", "cannot read secret: %v", err)
+			continue
+		}
+		*field.value = strings.TrimRight(string(data), "\r\n")
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ResolveSecretRef fills credentials that are still empty from the Kubernetes
+// Secret named by security.secret_ref. Missing keys are left empty, but the
+// password must be present when basic auth is the only login method.
+func (c *Config) ResolveSecretRef(ctx context.Context, reader SecretReader) error {
+	ref := c.Security.SecretRef
+	if ref.Name == "" {
+		return nil
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = c.Kubernetes.Namespace
+	}
+
+	data, err := reader.GetSecretData(ctx, namespace, ref.Name)
+	if err != nil {
+		return fmt.Errorf("failed to read secret %s/%s: %w", namespace, ref.Name, err)
+	}
+
+	for _, field := range c.secretFields() {
+		if *field.value != "" || field.keyRef == "" {
+			continue
+		}
+		if value, ok := data[field.keyRef]; ok {
+			*field.value = strings.TrimRight(string(value), "\r\n")
+		}
+	}
+
+	if c.passwordRequired() && c.Security.Password == "" {
+		return fmt.Errorf("secret %s/%s has no key %q for security.password", namespace, ref.Name, ref.PasswordKey)
+	}
+	return nil
+}
+
+func (c *Config) passwordRequired() bool {
+	sec := c.Security
+	return sec.EnableAuth && !sec.OIDC.Enabled && !sec.KubernetesAuth.Enabled
+}
+
+// EnvKeys returns every setting that can be overridden from the environment.
+// The variable name is WAF_ followed by the upper-cased key with dots replaced
+// by underscores, e.g. security.oidc.client_secret is WAF_SECURITY_OIDC_CLIENT_SECRET.
+func EnvKeys() []string {
+	known := make(map[string]bool)
+	collectKeys(reflect.TypeOf(Config{}), "", known)
+
+	keys := make([]string, 0, len(known))
+	for key := range known {
+		// Map settings such as group_roles have user-defined keys
+		if !strings.HasSuffix(key, ".*") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// EnvName returns the environment variable that overrides a setting
+func EnvName(key string) string {
+	return "WAF_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
@@ -0,0 +1,404 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ValidationError describes one invalid setting by its dotted config path
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationErrors collects every problem found in a configuration so they
+// can all be fixed in one go instead of one restart at a time
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, "invalid configuration:")
+	for _, err := range e {
+		lines = append(lines, "  - "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *ValidationErrors) add(field, format string, args ...interface{}) {
+	*e = append(*e, ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+var (
+	serverModes   = []string{"debug", "release", "test", "development", "production"}
+	tlsVersions   = []string{"1.0", "1.1", "1.2", "1.3"}
+	clientAuths   = []string{"none", "request", "require", "verify_if_given", "require_and_verify"}
+	applyStrategy = []string{"annotation", "configmap"}
+	roles         = []string{"admin", "viewer"}
+	channelTypes  = []string{"slack", "teams", "generic"}
+	// notificationEvents mirrors the models.Event* types
+	notificationEvents = []string{"policy_changed", "config_changed", "apply_failed", "drift_detected", "block_rate_spike", "alert_firing"}
+)
+
+// Validate checks the settings that would otherwise fail at request time and
+// returns ValidationErrors listing all of them
+func (c *Config) Validate() error {
+	var errs ValidationErrors
+
+	c.validateServer(&errs)
+	c.validateKubernetes(&errs)
+	validateURL(&errs, "metrics.victoria_metrics_url", c.Metrics.VictoriaMetricsURL, true)
+	validateURL(&errs, "metrics.vmalert_url", c.Metrics.VmalertURL, false)
+	validateURL(&errs, "metrics.alertmanager_url", c.Metrics.AlertmanagerURL, false)
+	if c.Metrics.WAFEvents.Enabled && c.Metrics.WAFEvents.PollInterval <= 0 {
+		errs.add("metrics.waf_events.poll_interval", "must be positive, got %s", c.Metrics.WAFEvents.PollInterval)
+	}
+	if c.Metrics.WAFEvents.Lag < 0 {
+		errs.add("metrics.waf_events.lag", "must not be negative, got %s", c.Metrics.WAFEvents.Lag)
+	}
+	if c.Metrics.AlertRules.ConfigMapName == "" {
+		errs.add("metrics.alert_rules.configmap_name", "must not be empty")
+	}
+	if c.Metrics.AlertRules.Group == "" {
+		errs.add("metrics.alert_rules.group", "must not be empty")
+	}
+	if c.Metrics.Silences.ConfigMapName == "" {
+		errs.add("metrics.silences.configmap_name", "must not be empty")
+	}
+	validateURL(&errs, "logs.victoria_logs_url", c.Logs.VictoriaLogsURL, true)
+	if strings.TrimSpace(c.Logs.ModSecurityFilter) == "" {
+		errs.add("logs.modsecurity_filter", "must not be empty")
+	}
+	if strings.TrimSpace(c.Logs.AuditLogFilter) == "" {
+		errs.add("logs.audit_log_filter", "must not be empty")
+	}
+	if c.Logs.Tail.MaxConcurrent < 0 {
+		errs.add("logs.tail.max_concurrent", "must not be negative, got %d", c.Logs.Tail.MaxConcurrent)
+	}
+	if c.Logs.Tail.BufferSize <= 0 {
+		errs.add("logs.tail.buffer_size", "must be positive, got %d", c.Logs.Tail.BufferSize)
+	}
+	if c.Logs.Tail.HeartbeatInterval <= 0 {
+		errs.add("logs.tail.heartbeat_interval", "must be positive, got %s", c.Logs.Tail.HeartbeatInterval)
+	}
+	if c.Logs.Tail.WriteTimeout <= 0 {
+		errs.add("logs.tail.write_timeout", "must be positive, got %s", c.Logs.Tail.WriteTimeout)
+	}
+	if c.Logs.Export.MaxConcurrent < 0 {
+		errs.add("logs.export.max_concurrent", "must not be negative, got %d", c.Logs.Export.MaxConcurrent)
+	}
+	if c.Logs.Export.ChunkDuration < time.Minute {
+		errs.add("logs.export.chunk_duration", "must be at least 1m, got %s", c.Logs.Export.ChunkDuration)
+	}
+	if c.Logs.Export.WriteTimeout <= 0 {
+		errs.add("logs.export.write_timeout", "must be positive, got %s", c.Logs.Export.WriteTimeout)
+	}
+	c.validateSecurity(&errs)
+	if c.Cache.TTL < 0 {
+		errs.add("cache.ttl", "must not be negative, got %s", c.Cache.TTL)
+	}
+	if c.Cache.MaxEntries <= 0 {
+		errs.add("cache.max_entries", "must be positive, got %d", c.Cache.MaxEntries)
+	}
+	if c.Health.CacheTTL < 0 {
+		errs.add("health.cache_ttl", "must not be negative, got %s", c.Health.CacheTTL)
+	}
+	if c.Health.Timeout <= 0 {
+		errs.add("health.timeout", "must be positive, got %s", c.Health.Timeout)
+	}
+	c.validateNotifications(&errs)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Config) validateNotifications(errs *ValidationErrors) {
+	n := c.Notifications
+	if n.QueueSize <= 0 {
+		errs.add("notifications.queue_size", "must be positive, got %d", n.QueueSize)
+	}
+	if n.Timeout <= 0 {
+		errs.add("notifications.timeout", "must be positive, got %s", n.Timeout)
+	}
+	if n.MaxRetries < 0 {
+		errs.add("notifications.max_retries", "must not be negative, got %d", n.MaxRetries)
+	}
+	if n.RetryBackoff <= 0 {
+		errs.add("notifications.retry_backoff", "must be positive, got %s", n.RetryBackoff)
+	}
+	if n.MaxRetryBackoff < n.RetryBackoff {
+		errs.add("notifications.max_retry_backoff", "must not be less than retry_backoff, got %s", n.MaxRetryBackoff)
+	}
+	if n.AlertPollInterval < 0 {
+		errs.add("notifications.alert_poll_interval", "must not be negative, got %s", n.AlertPollInterval)
+	}
+
+	names := make(map[string]bool, len(n.Channels))
+	for i, ch := range n.Channels {
+		field := fmt.Sprintf("notifications.channels[%d]", i)
+		if ch.Name == "" {
+			errs.add(field+".name", "is required")
+		} else if names[ch.Name] {
+			errs.add(field+".name", "duplicate channel name %q", ch.Name)
+		}
+		names[ch.Name] = true
+		if !oneOf(ch.Type, channelTypes) {
+			errs.add(field+".type", "must be one of %s, got %q", strings.Join(channelTypes, ", "), ch.Type)
+		}
+		validateURL(errs, field+".url", ch.URL, true)
+		for _, event := range ch.Events {
+			if !oneOf(event, notificationEvents) {
+				errs.add(field+".events", "must be one of %s, got %q", strings.Join(notificationEvents, ", "), event)
+			}
+		}
+		if ch.Template != "" {
+			if _, err := template.New(ch.Name).Funcs(NotificationTemplateFuncs).Parse(ch.Template); err != nil {
+				errs.add(field+".template", "invalid template: %v", err)
+			}
+		}
+	}
+}
+
+func (c *Config) validateServer(errs *ValidationErrors) {
+	s := c.Server
+	if s.Port <= 0 || s.Port > 65535 {
+		errs.add("server.port", "must be between 1 and 65535, got %d", s.Port)
+	}
+	if !oneOf(s.Mode, serverModes) {
+		errs.add("server.mode", "must be one of %s, got %q", strings.Join(serverModes, ", "), s.Mode)
+	}
+	for i, origin := range s.AllowOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			errs.add(fmt.Sprintf("server.allow_origins[%d]", i), "must be \"*\" or an origin like https://waf.example.com or https://*.example.com, got %q", origin)
+		}
+	}
+	if s.CORS.MaxAge < 0 {
+		errs.add("server.cors.max_age", "must not be negative, got %s", s.CORS.MaxAge)
+	}
+
+	t := s.TLS
+	if !t.Enabled {
+		return
+	}
+	if t.CertFile == "" {
+		errs.add("server.tls.cert_file", "is required when TLS is enabled")
+	}
+	if t.KeyFile == "" {
+		errs.add("server.tls.key_file", "is required when TLS is enabled")
+	}
+	if !oneOf(t.MinVersion, tlsVersions) {
+		errs.add("server.tls.min_version", "must be one of %s, got %q", strings.Join(tlsVersions, ", "), t.MinVersion)
+	}
+	if t.ClientAuth != "" && !oneOf(t.ClientAuth, clientAuths) {
+		errs.add("server.tls.client_auth", "must be one of %s, got %q", strings.Join(clientAuths, ", "), t.ClientAuth)
+	}
+	if len(t.CipherSuites) > 0 {
+		known := make(map[string]bool)
+		for _, suite := range tls.CipherSuites() {
+			known[suite.Name] = true
+		}
+		for i, name := range t.CipherSuites {
+			if !known[strings.TrimSpace(name)] {
+				errs.add(fmt.Sprintf("server.tls.cipher_suites[%d]", i), "unsupported or insecure cipher suite %q", name)
+			}
+		}
+	}
+}
+
+func (c *Config) validateKubernetes(errs *ValidationErrors) {
+	k := c.Kubernetes
+	if k.ConfigPath != "" {
+		if _, err := os.Stat(k.ConfigPath); err != nil {
+			errs.add("kubernetes.config_path", "cannot read kubeconfig: %v (leave empty to use the in-cluster service account)", err)
+		}
+	}
+	required := map[string]string{
+		"kubernetes.namespace":                          k.Namespace,
+		"kubernetes.ingress_controller_namespace":       k.IngressControllerNamespace,
+		"kubernetes.ingress_controller_configmap_name":  k.IngressControllerConfigMapName,
+		"kubernetes.ingress_controller_deployment_name": k.IngressControllerDeploymentName,
+		"kubernetes.waf_policies_configmap_name":        k.WAFPoliciesConfigMapName,
+		"kubernetes.default_ingress_namespace":          k.DefaultIngressNamespace,
+	}
+	// Sorted so that errors are reported in a stable order
+	for _, field := range sortedKeys(required) {
+		if strings.TrimSpace(required[field]) == "" {
+			errs.add(field, "must not be empty")
+		}
+	}
+	if !oneOf(k.DefaultApplyStrategy, applyStrategy) {
+		errs.add("kubernetes.default_apply_strategy", "must be one of %s, got %q", strings.Join(applyStrategy, ", "), k.DefaultApplyStrategy)
+	}
+	if k.DriftCheckInterval < 0 {
+		errs.add("kubernetes.drift_check_interval", "must not be negative, got %s", k.DriftCheckInterval)
+	}
+}
+
+func (c *Config) validateSecurity(errs *ValidationErrors) {
+	sec := c.Security
+	if c.passwordRequired() && sec.Password == "" && sec.SecretRef.Name == "" {
+		errs.add("security.password", "is required when enable_auth is true and neither oidc nor kubernetes_auth is enabled; set it inline, with password_file, secret_ref or WAF_SECURITY_PASSWORD")
+	}
+	if sec.Password != "" && sec.Username == "" {
+		errs.add("security.username", "is required when a password is set")
+	}
+	if sec.SessionTTL <= 0 {
+		errs.add("security.session_ttl", "must be positive, got %s", sec.SessionTTL)
+	}
+	if sec.KubernetesAuth.CacheTTL < 0 {
+		errs.add("security.kubernetes_auth.cache_ttl", "must not be negative, got %s", sec.KubernetesAuth.CacheTTL)
+	}
+
+	oidc := sec.OIDC
+	if !oidc.Enabled {
+		return
+	}
+	validateURL(errs, "security.oidc.issuer_url", oidc.IssuerURL, true)
+	validateURL(errs, "security.oidc.redirect_url", oidc.RedirectURL, true)
+	if oidc.ClientID == "" {
+		errs.add("security.oidc.client_id", "is required when OIDC is enabled")
+	}
+	if oidc.DefaultRole != "" && !oneOf(oidc.DefaultRole, roles) {
+		errs.add("security.oidc.default_role", "must be empty or one of %s, got %q", strings.Join(roles, ", "), oidc.DefaultRole)
+	}
+	for _, group := range sortedKeys(oidc.GroupRoles) {
+		if role := oidc.GroupRoles[group]; !oneOf(role, roles) {
+			errs.add("security.oidc.group_roles."+group, "must be one of %s, got %q", strings.Join(roles, ", "), role)
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func validateURL(errs *ValidationErrors, field, raw string, required bool) {
+	if raw == "" {
+		if required {
+			errs.add(field, "is required")
+		}
+		return
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.add(field, "must be an http(s) URL, got %q", raw)
+	}
+}
+
+func oneOf(value string, allowed []string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckUnknownKeys reports keys in the config file that do not map to any
+// setting, such as typos or options that were removed
+func CheckUnknownKeys() error {
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		return nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	known := make(map[string]bool)
+	collectKeys(reflect.TypeOf(Config{}), "", known)
+
+	var errs ValidationErrors
+	for _, key := range v.AllKeys() {
+		if !isKnownKey(key, known) {
+			errs.add(key, "unknown setting")
+		}
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+		return errs
+	}
+	return nil
+}
+
+// collectKeys records the dotted mapstructure path of every field. Map fields
+// are recorded with a trailing ".*" since their keys are user-defined.
+func collectKeys(t reflect.Type, prefix string, known map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" {
+			continue
+		}
+		key := prefix + name
+
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			if field.Type.PkgPath() == t.PkgPath() {
+				collectKeys(field.Type, key+".", known)
+				continue
+			}
+		case reflect.Map:
+			known[key+".*"] = true
+			continue
+		}
+		known[key] = true
+	}
+}
+
+func isKnownKey(key string, known map[string]bool) bool {
+	if known[key] {
+		return true
+	}
+	for i := strings.LastIndex(key, "."); i > 0; i = strings.LastIndex(key[:i], ".") {
+		if known[key[:i]+".*"] {
+			return true
+		}
+	}
+	return false
+}
+
+// validateLoaded runs the full validation of a freshly loaded config,
+// including the unknown-key check against the file it came from
+func validateLoaded(c *Config) error {
+	var errs ValidationErrors
+	for _, err := range []error{CheckUnknownKeys(), c.Validate()} {
+		switch e := err.(type) {
+		case nil:
+		case ValidationErrors:
+			errs = append(errs, e...)
+		default:
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+var watchMutex sync.Mutex
+
+// WatchConfig reloads the config file whenever it changes. The new config is
+// validated before onChange is called with the previous and new values;
+// invalid files are reported to onError and the running config is kept.
+// Nothing is watched when the config came only from defaults and environment.
+func WatchConfig(onChange func(oldConfig, newConfig *Config) error, onError func(error)) {
+	if viper.ConfigFileUsed() == "" {
+		return
+	}
+
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		watchMutex.Lock()
+		defer watchMutex.Unlock()
+
+		config, err := decode()
+		if err != nil {
+			onError(fmt.Errorf("invalid config in %s: %w", e.Name, err))
+			return
+		}
+
+		if err := onChange(GlobalConfig, config); err != nil {
+			onError(fmt.Errorf("failed to apply %s: %w", e.Name, err))
+			return
+		}
+		GlobalConfig = config
+	})
+	viper.WatchConfig()
+}
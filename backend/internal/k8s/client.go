@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"waf-admin/internal/config"
@@ -13,6 +15,8 @@ import (
 
 	"github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -26,7 +30,7 @@ import (
 
 type Client struct {
 	clientset *kubernetes.Clientset
-	config    *config.Config
+	config    atomic.Pointer[config.Config]
 	logger    *logrus.Logger
 }
 
@@ -50,16 +54,25 @@ func NewClient(cfg *config.Config, logger *logrus.Logger) (*Client, error) {
 		return nil, fmt.Errorf("failed to create kubernetes config: %w", err)
 	}
 
+	kubeConfig.Wrap(instrument)
+
 	clientset, err := kubernetes.NewForConfig(kubeConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
 	}
 
-	return &Client{
+	c := &Client{
 		clientset: clientset,
-		config:    cfg,
 		logger:    logger,
-	}, nil
+	}
+	c.config.Store(cfg)
+	return c, nil
+}
+
+// UpdateConfig swaps in a reloaded configuration. Connection settings such
+// as the kubeconfig path only take effect after a restart.
+func (c *Client) UpdateConfig(cfg *config.Config) {
+	c.config.Store(cfg)
 }
 
 func (c *Client) GetConfigMap(ctx context.Context, namespace, name string) (*corev1.ConfigMap, error) {
@@ -75,6 +88,15 @@ func (c *Client) UpdateConfigMap(ctx context.Context, namespace string, configMa
 	return err
 }
 
+// GetSecretData returns the decoded data of a Secret
+func (c *Client) GetSecretData(ctx context.Context, namespace, name string) (map[string][]byte, error) {
+	secret, err := c.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return secret.Data, nil
+}
+
 func (c *Client) GetIngress(ctx context.Context, namespace, name string) (*networkingv1.Ingress, error) {
 	return c.clientset.NetworkingV1().Ingresses(namespace).Get(ctx, name, metav1.GetOptions{})
 }
@@ -109,7 +131,7 @@ func (c *Client) RolloutDeployment(ctx context.Context, namespace, name string)
 }
 
 func (c *Client) GetWAFPolicyConfigMap(ctx context.Context) (*corev1.ConfigMap, error) {
-    configMap, err := c.GetConfigMap(ctx, c.config.Kubernetes.Namespace, c.config.Kubernetes.WAFPoliciesConfigMapName)
+    configMap, err := c.GetConfigMap(ctx, c.config.Load().Kubernetes.Namespace, c.config.Load().Kubernetes.WAFPoliciesConfigMapName)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			return c.createWAFPolicyConfigMap(ctx)
@@ -122,8 +144,8 @@ func (c *Client) GetWAFPolicyConfigMap(ctx context.Context) (*corev1.ConfigMap,
 func (c *Client) createWAFPolicyConfigMap(ctx context.Context) (*corev1.ConfigMap, error) {
     configMap := &corev1.ConfigMap{
         ObjectMeta: metav1.ObjectMeta{
-            Name:      c.config.Kubernetes.WAFPoliciesConfigMapName,
-            Namespace: c.config.Kubernetes.Namespace,
+            Name:      c.config.Load().Kubernetes.WAFPoliciesConfigMapName,
+            Namespace: c.config.Load().Kubernetes.Namespace,
             Labels: map[string]string{
                 "app": "waf-admin",
             },
@@ -133,11 +155,11 @@ func (c *Client) createWAFPolicyConfigMap(ctx context.Context) (*corev1.ConfigMa
         },
     }
 
-	return c.clientset.CoreV1().ConfigMaps(c.config.Kubernetes.Namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	return c.clientset.CoreV1().ConfigMaps(c.config.Load().Kubernetes.Namespace).Create(ctx, configMap, metav1.CreateOptions{})
 }
 
 func (c *Client) GetIngressNGINXControllerConfigMap(ctx context.Context) (*corev1.ConfigMap, error) {
-    return c.GetConfigMap(ctx, c.config.Kubernetes.IngressControllerNamespace, c.config.Kubernetes.IngressControllerConfigMapName)
+    return c.GetConfigMap(ctx, c.config.Load().Kubernetes.IngressControllerNamespace, c.config.Load().Kubernetes.IngressControllerConfigMapName)
 }
 
 func (c *Client) ApplyWAFPolicyToIngress(ctx context.Context, namespace string, host string, policy models.WAFPolicy) error {
@@ -159,40 +181,130 @@ func (c *Client) ApplyWAFPolicyToIngress(ctx context.Context, namespace string,
     return c.createIngressForHost(ctx, namespace, host, policy)
 }
 
+// Annotations recording which policy version was applied, so that drift
+// checks only compare objects against the policy version they were given
+const (
+	// PolicyVersionAnnotation is set on an Ingress to the applied policy's
+	// version
+	PolicyVersionAnnotation = "waf-admin/policy-version"
+	// AppliedPolicyAnnotation is set on the controller ConfigMap to
+	// "<namespace>/<host>@<version>" of the applied policy
+	AppliedPolicyAnnotation = "waf-admin/applied-policy"
+
+	annotationEnableModSecurity = "nginx.ingress.kubernetes.io/enable-modsecurity"
+	annotationEnableCRS         = "nginx.ingress.kubernetes.io/enable-owasp-core-rules"
+	annotationSnippet           = "nginx.ingress.kubernetes.io/modsecurity-snippet"
+)
+
 func (c *Client) applyPolicyToIngress(ctx context.Context, ingress *networkingv1.Ingress, policy models.WAFPolicy) error {
 	if ingress.Annotations == nil {
 		ingress.Annotations = make(map[string]string)
 	}
 
-	if policy.Mode == string(models.WAFModeOn) {
-		ingress.Annotations["nginx.ingress.kubernetes.io/enable-modsecurity"] = "true"
-		ingress.Annotations["nginx.ingress.kubernetes.io/enable-owasp-core-rules"] = "true"
-		
-		// Always generate snippet to include exceptions and custom rules
-		snippet := c.generateModSecuritySnippet(policy)
-		if snippet != "" {
-			ingress.Annotations["nginx.ingress.kubernetes.io/modsecurity-snippet"] = snippet
+	for key, value := range c.ingressAnnotations(policy) {
+		if value == "" {
+			delete(ingress.Annotations, key)
 		} else {
-			delete(ingress.Annotations, "nginx.ingress.kubernetes.io/modsecurity-snippet")
+			ingress.Annotations[key] = value
 		}
-	} else if policy.Mode == string(models.WAFModeDetectionOnly) {
-		ingress.Annotations["nginx.ingress.kubernetes.io/enable-modsecurity"] = "true"
-		ingress.Annotations["nginx.ingress.kubernetes.io/enable-owasp-core-rules"] = "true"
-		
+	}
+	ingress.Annotations[PolicyVersionAnnotation] = strconv.Itoa(policy.Version)
+
+	return c.UpdateIngress(ctx, ingress.Namespace, ingress)
+}
+
+// ingressAnnotations returns the ModSecurity annotations a policy sets on
+// its Ingress; an empty value means the annotation is removed
+func (c *Client) ingressAnnotations(policy models.WAFPolicy) map[string]string {
+	annotations := map[string]string{
+		annotationEnableModSecurity: "",
+		annotationEnableCRS:         "",
+		annotationSnippet:           "",
+	}
+	switch policy.Mode {
+	case string(models.WAFModeOn):
+		annotations[annotationEnableModSecurity] = "true"
+		annotations[annotationEnableCRS] = "true"
+		// Always generate snippet to include exceptions and custom rules
+		annotations[annotationSnippet] = c.generateModSecuritySnippet(policy)
+	case string(models.WAFModeDetectionOnly):
+		annotations[annotationEnableModSecurity] = "true"
+		annotations[annotationEnableCRS] = "true"
 		// Generate snippet for detection mode with exceptions
-		snippet := "SecRuleEngine DetectionOnly\n"
-		exceptionSnippet := c.generateModSecuritySnippet(policy)
-		if exceptionSnippet != "" {
-			snippet += exceptionSnippet
+		annotations[annotationSnippet] = "SecRuleEngine DetectionOnly\n" + c.generateModSecuritySnippet(policy)
+	}
+	return annotations
+}
+
+// findIngressForHost returns the first Ingress in the namespace with a rule
+// for host, or nil when there is none
+func (c *Client) findIngressForHost(ctx context.Context, namespace, host string) (*networkingv1.Ingress, error) {
+	ingressList, err := c.clientset.NetworkingV1().Ingresses(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+	for i := range ingressList.Items {
+		for _, rule := range ingressList.Items[i].Spec.Rules {
+			if rule.Host == host {
+				return &ingressList.Items[i], nil
+			}
 		}
-		ingress.Annotations["nginx.ingress.kubernetes.io/modsecurity-snippet"] = snippet
-	} else {
-		delete(ingress.Annotations, "nginx.ingress.kubernetes.io/enable-modsecurity")
-		delete(ingress.Annotations, "nginx.ingress.kubernetes.io/enable-owasp-core-rules")
-		delete(ingress.Annotations, "nginx.ingress.kubernetes.io/modsecurity-snippet")
 	}
+	return nil, nil
+}
 
-	return c.UpdateIngress(ctx, ingress.Namespace, ingress)
+// HasIngressForHost reports whether an Ingress in the namespace has a rule
+// for host, that is whether ApplyWAFPolicyToIngress updates an Ingress
+// rather than creating one
+func (c *Client) HasIngressForHost(ctx context.Context, namespace, host string) (bool, error) {
+	ingress, err := c.findIngressForHost(ctx, namespace, host)
+	return ingress != nil, err
+}
+
+// IngressDrift compares the Ingress of a policy with the annotations the
+// policy renders to and describes the first difference. Ingresses the
+// policy's current version was not applied to are not compared: the policy
+// was changed but not applied yet, or was applied to the controller.
+func (c *Client) IngressDrift(ctx context.Context, policy models.WAFPolicy) (string, error) {
+	ingress, err := c.findIngressForHost(ctx, policy.Namespace, policy.Host)
+	if err != nil || ingress == nil {
+		return "", err
+	}
+	if ingress.Annotations[PolicyVersionAnnotation] != strconv.Itoa(policy.Version) {
+		return "", nil
+	}
+	want := c.ingressAnnotations(policy)
+	for _, key := range []string{annotationEnableModSecurity, annotationEnableCRS, annotationSnippet} {
+		if ingress.Annotations[key] != want[key] {
+			return fmt.Sprintf("annotation %s of ingress %s/%s differs from the applied policy", key, ingress.Namespace, ingress.Name), nil
+		}
+	}
+	return "", nil
+}
+
+// ControllerDrift compares the controller ConfigMap with the snippet of the
+// policy last applied to it, if that policy is in policies at the applied
+// version. It returns the policy's key and a description of the difference.
+func (c *Client) ControllerDrift(ctx context.Context, policies map[string]models.WAFPolicy) (string, string, error) {
+	configMap, err := c.GetIngressNGINXControllerConfigMap(ctx)
+	if errors.IsNotFound(err) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get controller configmap: %w", err)
+	}
+	key, version, ok := strings.Cut(configMap.Annotations[AppliedPolicyAnnotation], "@")
+	if !ok {
+		return "", "", nil
+	}
+	policy, exists := policies[key]
+	if !exists || strconv.Itoa(policy.Version) != version {
+		return "", "", nil
+	}
+	if configMap.Data["modsecurity-snippet"] != c.generateControllerModSecuritySnippet(policy) {
+		return key, fmt.Sprintf("modsecurity-snippet of configmap %s/%s differs from the applied policy", configMap.Namespace, configMap.Name), nil
+	}
+	return "", "", nil
 }
 
 func (c *Client) createIngressForHost(ctx context.Context, namespace string, host string, policy models.WAFPolicy) error {
@@ -205,8 +317,8 @@ func (c *Client) createIngressForHost(ctx context.Context, namespace string, hos
     backendService := ""
     backendPort := int32(80)
     
-    if len(c.config.Kubernetes.DefaultBackendServices) > 0 {
-        for _, candidate := range c.config.Kubernetes.DefaultBackendServices {
+    if len(c.config.Load().Kubernetes.DefaultBackendServices) > 0 {
+        for _, candidate := range c.config.Load().Kubernetes.DefaultBackendServices {
             for _, svc := range services.Items {
                 if svc.Name == candidate {
                     backendService = candidate
@@ -333,8 +445,12 @@ func (c *Client) ApplyWAFPolicyToController(ctx context.Context, policy models.W
 
 	snippet := c.generateControllerModSecuritySnippet(policy)
 	configMap.Data["modsecurity-snippet"] = snippet
+	if configMap.Annotations == nil {
+		configMap.Annotations = make(map[string]string)
+	}
+	configMap.Annotations[AppliedPolicyAnnotation] = fmt.Sprintf("%s/%s@%d", policy.Namespace, policy.Host, policy.Version)
 
-    return c.UpdateConfigMap(ctx, c.config.Kubernetes.IngressControllerNamespace, configMap)
+    return c.UpdateConfigMap(ctx, c.config.Load().Kubernetes.IngressControllerNamespace, configMap)
 }
 
 func (c *Client) generateControllerModSecuritySnippet(policy models.WAFPolicy) string {
@@ -360,4 +476,70 @@ func (c *Client) generateControllerModSecuritySnippet(policy models.WAFPolicy) s
 	}
 
 	return snippet
-}
\ No newline at end of file
+}
+
+// ReviewToken validates a caller's bearer token with the TokenReview API
+func (c *Client) ReviewToken(ctx context.Context, token string, audiences []string) (*authenticationv1.UserInfo, error) {
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: audiences,
+		},
+	}
+
+	result, err := c.clientset.AuthenticationV1().TokenReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token review: %w", err)
+	}
+	if !result.Status.Authenticated {
+		return nil, fmt.Errorf("token not authenticated: %s", result.Status.Error)
+	}
+	return &result.Status.User, nil
+}
+
+// CheckAccess asks the SubjectAccessReview API whether the user may perform
+// the action, returning the authorizer's reason when access is denied
+func (c *Client) CheckAccess(ctx context.Context, user authenticationv1.UserInfo, attrs authorizationv1.ResourceAttributes) (bool, string, error) {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:               user.Username,
+			UID:                user.UID,
+			Groups:             user.Groups,
+			Extra:              extra,
+			ResourceAttributes: &attrs,
+		},
+	}
+
+	result, err := c.clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("failed to create subject access review: %w", err)
+	}
+	return result.Status.Allowed, result.Status.Reason, nil
+}
+
+// Ping checks that the API server is reachable and answering requests
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Raw()
+	return err
+}
+
+// CanI asks the SelfSubjectAccessReview API whether the backend's own
+// service account may perform the action
+func (c *Client) CanI(ctx context.Context, attrs authorizationv1.ResourceAttributes) (bool, string, error) {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &attrs,
+		},
+	}
+
+	result, err := c.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("failed to create self subject access review: %w", err)
+	}
+	return result.Status.Allowed, result.Status.Reason, nil
+}
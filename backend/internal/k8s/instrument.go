@@ -0,0 +1,61 @@
+package k8s
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var apiRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "waf_admin_kubernetes_requests_total",
+	Help: "Requests to the Kubernetes API by HTTP method, resource and status code (\"error\" when no response was received).",
+}, []string{"method", "resource", "code"})
+
+// instrumentedTransport counts the Kubernetes API calls made by the clientset
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func instrument(rt http.RoundTripper) http.RoundTripper {
+	return &instrumentedTransport{next: rt}
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	apiRequests.WithLabelValues(req.Method, resourceFromPath(req.URL.Path), code).Inc()
+	return resp, err
+}
+
+// resourceFromPath returns the resource type of an API path, e.g.
+// "configmaps" for /api/v1/namespaces/waf-admin/configmaps/waf-policies or
+// "ingresses" for /apis/networking.k8s.io/v1/namespaces/default/ingresses,
+// so that object names do not end up in metric labels
+func resourceFromPath(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	var i int
+	switch {
+	case len(parts) > 0 && parts[0] == "api":
+		i = 2
+	case len(parts) > 0 && parts[0] == "apis":
+		i = 3
+	default:
+		return "other"
+	}
+	// Skip the namespace scope unless the namespace is the object itself
+	if len(parts) > i+2 && parts[i] == "namespaces" {
+		i += 2
+	}
+	if len(parts) <= i {
+		return "discovery"
+	}
+	return parts[i]
+}
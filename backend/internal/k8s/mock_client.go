@@ -8,6 +8,8 @@ import (
 	"waf-admin/internal/config"
 	"waf-admin/internal/models"
 
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -234,4 +236,34 @@ func (c *MockClient) RolloutDeployment(ctx context.Context, namespace, deploymen
 	
 	c.logger.Infof("Mock rollout deployment %s in namespace %s", deploymentName, namespace)
 	return nil
-}
\ No newline at end of file
+}
+
+func (c *MockClient) ReviewToken(ctx context.Context, token string, audiences []string) (*authenticationv1.UserInfo, error) {
+	if token == "" {
+		return nil, fmt.Errorf("token not authenticated")
+	}
+	return &authenticationv1.UserInfo{
+		Username: "mock-user",
+		Groups:   []string{"system:authenticated"},
+	}, nil
+}
+
+func (c *MockClient) CheckAccess(ctx context.Context, user authenticationv1.UserInfo, attrs authorizationv1.ResourceAttributes) (bool, string, error) {
+	c.logger.Infof("Mock access review for %s: %s %s in namespace %s", user.Username, attrs.Verb, attrs.Resource, attrs.Namespace)
+	return true, "", nil
+}
+
+func (c *MockClient) GetSecretData(ctx context.Context, namespace, name string) (map[string][]byte, error) {
+	return map[string][]byte{
+		"password":       []byte("mock-password"),
+		"session_secret": []byte("mock-session-secret"),
+	}, nil
+}
+
+func (c *MockClient) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (c *MockClient) CanI(ctx context.Context, attrs authorizationv1.ResourceAttributes) (bool, string, error) {
+	return true, "", nil
+}
@@ -62,6 +62,12 @@ type MetricsSummary struct {
 	TopPaths        []PathMetrics      `json:"top_paths"`
 	TopRuleIDs      []RuleMetrics      `json:"top_rule_ids"`
 	TimeRange       TimeRange          `json:"time_range"`
+	// WAFBlockedSource is "modsecurity" when WAFBlocked counts ModSecurity
+	// interventions and "status_403" when it falls back to 403 responses
+	WAFBlockedSource string `json:"waf_blocked_source"`
+	// Warnings lists queries that failed or returned partial data; the
+	// affected fields are zero or incomplete
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 // HostMetrics represents metrics for a specific host
@@ -87,6 +93,61 @@ type RuleMetrics struct {
 	Count    int64  `json:"count"`
 }
 
+// TimeSeriesPoint is a single sample of a time series
+type TimeSeriesPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// TimeSeries is one metric for one host over a time range
+type TimeSeries struct {
+	Metric string            `json:"metric"`
+	Host   string            `json:"host"`
+	Points []TimeSeriesPoint `json:"points"`
+}
+
+// TimeSeriesResult holds the chart series for a time range. Step is the
+// resolution in seconds chosen for the range.
+type TimeSeriesResult struct {
+	TimeRange TimeRange    `json:"time_range"`
+	Step      int64        `json:"step"`
+	Series    []TimeSeries `json:"series"`
+	// BlockedRatioSource is the source of the blocked_ratio series, as
+	// MetricsSummary.WAFBlockedSource
+	BlockedRatioSource string `json:"blocked_ratio_source"`
+}
+
+// Sources of blocked request counts
+const (
+	BlockedSourceModSecurity = "modsecurity"
+	BlockedSourceStatus403   = "status_403"
+)
+
+// Readiness states, from best to worst
+const (
+	ReadinessOK          = "ok"
+	ReadinessDegraded    = "degraded"
+	ReadinessUnavailable = "unavailable"
+)
+
+// DependencyStatus is the result of probing one dependency. A critical
+// dependency that is down makes the backend unavailable; any other makes it
+// degraded.
+type DependencyStatus struct {
+	Name      string  `json:"name"`
+	Up        bool    `json:"up"`
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ReadinessReport is the combined result of the dependency probes
+type ReadinessReport struct {
+	Status       string             `json:"status"`
+	CheckedAt    time.Time          `json:"checked_at"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
 // TimeRange represents a time range for queries
 type TimeRange struct {
 	Start time.Time `json:"start"`
@@ -106,18 +167,152 @@ type LogEntry struct {
 	Method    string                 `json:"method"`
 }
 
-// LogQuery represents a log query
+// LogQuery represents a log query. The typed filters are ANDed together;
+// values within one filter are alternatives. Query is raw LogsQL and is
+// only accepted when Advanced is set.
 type LogQuery struct {
-	Query     string    `json:"query"`
-	TimeRange TimeRange `json:"time_range"`
-	Limit     int       `json:"limit"`
-	Offset    int       `json:"offset"`
+	Query      string        `json:"query"`
+	Advanced   bool          `json:"advanced"`
+	Hosts      []string      `json:"hosts,omitempty"`
+	Status     []StatusRange `json:"status,omitempty"`
+	Methods    []string      `json:"methods,omitempty"`
+	ClientIPs  []string      `json:"client_ips,omitempty"`
+	RuleIDs    []string      `json:"rule_ids,omitempty"`
+	PathPrefix string        `json:"path_prefix,omitempty"`
+	Text       string        `json:"text,omitempty"`
+	TimeRange  TimeRange     `json:"time_range"`
+	Limit      int           `json:"limit"`
+	Offset     int           `json:"offset"`
+}
+
+// StatusRange matches HTTP status codes from Min to Max inclusive; a zero
+// Max matches Min only
+type StatusRange struct {
+	Min int `json:"min"`
+	Max int `json:"max,omitempty"`
 }
 
 // LogSearchResult represents the result of a log search
 type LogSearchResult struct {
 	Entries    []LogEntry `json:"entries"`
 	Total      int        `json:"total"`
+	HasMore    bool       `json:"has_more"`
+	TimeRange  TimeRange  `json:"time_range"`
+}
+
+// Log export formats
+const (
+	ExportFormatCSV     = "csv"
+	ExportFormatNDJSON  = "ndjson"
+	ExportFormatParquet = "parquet"
+)
+
+// LogExportRequest exports every entry matching the embedded log query,
+// whose time range is required and whose limit and offset are ignored.
+// Columns are log field names; timestamp, message and client_ip name the
+// entry time, message and remote address.
+type LogExportRequest struct {
+	LogQuery
+	Format  string   `json:"format"`
+	Columns []string `json:"columns,omitempty"`
+	Gzip    bool     `json:"gzip"`
+}
+
+// LogFieldValue is a value of a log field and the number of entries with it
+type LogFieldValue struct {
+	Value string `json:"value"`
+	Hits  int64  `json:"hits"`
+}
+
+// LogFilters lists the values of the filterable log fields over a time
+// range, most frequent first. Warnings lists fields whose query failed.
+type LogFilters struct {
+	TimeRange TimeRange       `json:"time_range"`
+	Hosts     []LogFieldValue `json:"hosts"`
+	Status    []LogFieldValue `json:"status"`
+	Methods   []LogFieldValue `json:"methods"`
+	RuleIDs   []LogFieldValue `json:"rule_ids"`
+	Warnings  []string        `json:"warnings,omitempty"`
+}
+
+// WAF event actions
+const (
+	WAFActionBlocked  = "blocked"
+	WAFActionDetected = "detected"
+	WAFActionPassed   = "passed"
+)
+
+// WAFEvent is one ModSecurity audit log record: a transaction and the rules
+// it matched. AnomalyScore is the inbound CRS anomaly score reported by the
+// blocking evaluation rules, if any ran.
+type WAFEvent struct {
+	TransactionID        string           `json:"transaction_id"`
+	Timestamp            time.Time        `json:"timestamp"`
+	Host                 string           `json:"host"`
+	URI                  string           `json:"uri"`
+	Method               string           `json:"method"`
+	ClientIP             string           `json:"client_ip"`
+	ClientPort           int              `json:"client_port,omitempty"`
+	ServerIP             string           `json:"server_ip,omitempty"`
+	ServerPort           int              `json:"server_port,omitempty"`
+	Status               int              `json:"status"`
+	Action               string           `json:"action"`
+	AnomalyScore         int              `json:"anomaly_score"`
+	OutboundAnomalyScore int              `json:"outbound_anomaly_score,omitempty"`
+	Rules                []WAFMatchedRule `json:"rules"`
+	Request              WAFRequest       `json:"request"`
+	Response             WAFResponse      `json:"response"`
+}
+
+// WAFMatchedRule is one rule message in an audit log record
+type WAFMatchedRule struct {
+	ID       string   `json:"id"`
+	Message  string   `json:"message"`
+	Match    string   `json:"match,omitempty"`
+	Data     string   `json:"data,omitempty"`
+	Severity string   `json:"severity,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	File     string   `json:"file,omitempty"`
+	Line     string   `json:"line,omitempty"`
+}
+
+// WAFRequest is the request part of an audited transaction
+type WAFRequest struct {
+	Method      string            `json:"method"`
+	URI         string            `json:"uri"`
+	HTTPVersion string            `json:"http_version,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Body        string            `json:"body,omitempty"`
+}
+
+// WAFResponse is the response part of an audited transaction
+type WAFResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// WAFEventQuery selects audit log records. Filters are matched exactly
+// against the parsed records.
+type WAFEventQuery struct {
+	Host      string    `json:"host,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	RuleID    string    `json:"rule_id,omitempty"`
+	Action    string    `json:"action,omitempty"`
+	TimeRange TimeRange `json:"time_range"`
+	Limit     int       `json:"limit"`
+	Offset    int       `json:"offset"`
+}
+
+// WAFEventsResult is one page of WAF events, newest first. NextOffset is
+// the offset of the next page in audit log records, which can be more than
+// Offset plus the number of events when records did not match or could not
+// be parsed.
+type WAFEventsResult struct {
+	Events     []WAFEvent `json:"events"`
+	NextOffset int        `json:"next_offset"`
+	HasMore    bool       `json:"has_more"`
+	Skipped    int        `json:"skipped"`
 	TimeRange  TimeRange  `json:"time_range"`
 }
 
@@ -132,6 +327,34 @@ type AlertRule struct {
 	Enabled     bool      `json:"enabled"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	// Managed is set for rules created through the API, which can be edited
+	// and deleted; other rules come from static vmalert rule files
+	Managed bool `json:"managed"`
+	// Group, State, Health and LastError are reported by vmalert for rules
+	// it has loaded
+	Group     string `json:"group,omitempty"`
+	State     string `json:"state,omitempty"`
+	Health    string `json:"health,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// AlertRuleRequest creates or replaces a managed alert rule
+type AlertRuleRequest struct {
+	Name        string            `json:"name" binding:"required"`
+	Expression  string            `json:"expression" binding:"required"`
+	For         string            `json:"for"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	Enabled     *bool             `json:"enabled"`
+}
+
+// AlertFilter selects alerts and rules; empty fields match everything
+type AlertFilter struct {
+	State    string
+	Severity string
+	Host     string
+	// IncludeSilenced keeps alerts muted by an active silence
+	IncludeSilenced bool
 }
 
 // Alert represents an active alert
@@ -144,6 +367,100 @@ type Alert struct {
 	StartsAt     time.Time `json:"starts_at"`
 	EndsAt       time.Time `json:"ends_at"`
 	GeneratorURL string    `json:"generator_url"`
+	Silenced     bool      `json:"silenced"`
+	SilencedBy   []string  `json:"silenced_by,omitempty"`
+	// Acknowledgement is set while someone has acknowledged the alert
+	Acknowledgement *AlertAcknowledgement `json:"acknowledgement,omitempty"`
+}
+
+// AlertAcknowledgement records who took charge of an alert and when. It
+// lasts until the alert resolves: an alert that fires again has a new
+// StartsAt and is no longer acknowledged.
+type AlertAcknowledgement struct {
+	AlertID        string    `json:"alert_id"`
+	AlertName      string    `json:"alert_name"`
+	AlertStartsAt  time.Time `json:"alert_starts_at"`
+	AcknowledgedBy string    `json:"acknowledged_by"`
+	AcknowledgedAt time.Time `json:"acknowledged_at"`
+	Comment        string    `json:"comment,omitempty"`
+}
+
+// AcknowledgementRequest acknowledges the active alert with AlertID
+type AcknowledgementRequest struct {
+	AlertID string `json:"alert_id" binding:"required"`
+	Comment string `json:"comment"`
+}
+
+// Silence states, following Alertmanager
+const (
+	SilenceActive  = "active"
+	SilencePending = "pending"
+	SilenceExpired = "expired"
+)
+
+// SilenceMatcher matches one alert label. IsEqual false negates the match.
+type SilenceMatcher struct {
+	Name    string `json:"name" binding:"required"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"is_regex"`
+	IsEqual *bool  `json:"is_equal,omitempty"`
+}
+
+// Silence mutes the alerts whose labels match all of its matchers between
+// StartsAt and EndsAt
+type Silence struct {
+	ID        string           `json:"id"`
+	Matchers  []SilenceMatcher `json:"matchers"`
+	StartsAt  time.Time        `json:"starts_at"`
+	EndsAt    time.Time        `json:"ends_at"`
+	CreatedBy string           `json:"created_by"`
+	Comment   string           `json:"comment"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	State     string           `json:"state"`
+}
+
+// SilenceRequest creates a silence. StartsAt defaults to now; the end is
+// given either as EndsAt or as a Duration such as "2h".
+type SilenceRequest struct {
+	Matchers []SilenceMatcher `json:"matchers" binding:"required,min=1,dive"`
+	StartsAt *time.Time       `json:"starts_at"`
+	EndsAt   *time.Time       `json:"ends_at"`
+	Duration string           `json:"duration"`
+	Comment  string           `json:"comment" binding:"required"`
+}
+
+// Notification event types
+const (
+	EventPolicyChanged  = "policy_changed"
+	EventConfigChanged  = "config_changed"
+	EventApplyFailed    = "apply_failed"
+	EventDriftDetected  = "drift_detected"
+	EventBlockRateSpike = "block_rate_spike"
+	EventAlertFiring    = "alert_firing"
+)
+
+// NotificationEvent is sent to the webhook channels subscribed to its type.
+// Details holds the audit log or alert the event was raised for.
+type NotificationEvent struct {
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	Severity  string            `json:"severity"`
+	Title     string            `json:"title"`
+	Message   string            `json:"message"`
+	Host      string            `json:"host,omitempty"`
+	User      string            `json:"user,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Details   interface{}       `json:"details,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// DeadLetter records a notification that could not be delivered
+type DeadLetter struct {
+	Channel   string            `json:"channel"`
+	Event     NotificationEvent `json:"event"`
+	Attempts  int               `json:"attempts"`
+	Error     string            `json:"error"`
+	Timestamp time.Time         `json:"timestamp"`
 }
 
 // AuditLog represents a configuration change audit log
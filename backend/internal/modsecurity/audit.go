@@ -0,0 +1,120 @@
+// Package modsecurity parses the ModSecurity audit log records written by
+// ingress-nginx into WAF events. Both libmodsecurity's JSON format
+// (SecAuditLogFormat JSON) and the native serial format with lettered
+// sections are supported.
+package modsecurity
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"waf-admin/internal/models"
+)
+
+// ErrUnrecognized is returned for input that is neither a JSON nor a
+// native audit log record
+var ErrUnrecognized = errors.New("not a ModSecurity audit log record")
+
+// severities maps the numeric severities logged by libmodsecurity to the
+// names used in rule definitions
+var severities = map[string]string{
+	"0": "emergency",
+	"1": "alert",
+	"2": "critical",
+	"3": "error",
+	"4": "warning",
+	"5": "notice",
+	"6": "info",
+	"7": "debug",
+}
+
+// The CRS blocking evaluation rules report the total score in their
+// message, e.g. "Inbound Anomaly Score Exceeded (Total Score: 5)" or, from
+// the reporting rule, "(Total Inbound Score: 5 - SQLI=5,...)"
+var anomalyScorePattern = regexp.MustCompile(`Anomaly Score Exceeded \((?:Total (?:Inbound |Outbound )?Score|score):? (\d+)`)
+
+// Parse parses one audit log record, detecting its format
+func Parse(record []byte) (*models.WAFEvent, error) {
+	trimmed := bytes.TrimSpace(record)
+	switch {
+	case len(trimmed) == 0:
+		return nil, ErrUnrecognized
+	case trimmed[0] == '{':
+		return ParseJSON(trimmed)
+	case trimmed[0] == '-':
+		return ParseNative(trimmed)
+	default:
+		return nil, ErrUnrecognized
+	}
+}
+
+// finish fills in the fields derived from the matched rules and request
+func finish(event *models.WAFEvent) {
+	if event.Rules == nil {
+		event.Rules = []models.WAFMatchedRule{}
+	}
+	if event.Host == "" {
+		event.Host = stripPort(header(event.Request.Headers, "Host"))
+	}
+	if event.URI == "" {
+		event.URI = event.Request.URI
+	}
+	if event.Method == "" {
+		event.Method = event.Request.Method
+	}
+	if event.Status == 0 {
+		event.Status = event.Response.Status
+	}
+
+	for _, rule := range event.Rules {
+		m := anomalyScorePattern.FindStringSubmatch(rule.Message)
+		if m == nil {
+			continue
+		}
+		score, _ := strconv.Atoi(m[1])
+		if strings.Contains(rule.Message, "Outbound") {
+			event.OutboundAnomalyScore = max(event.OutboundAnomalyScore, score)
+		} else {
+			event.AnomalyScore = max(event.AnomalyScore, score)
+		}
+	}
+}
+
+// stripPort removes the port from a Host header value. IPv6 addresses keep
+// their brackets; a bare IPv6 address has no port to remove.
+func stripPort(host string) string {
+	if strings.HasPrefix(host, "[") {
+		if i := strings.IndexByte(host, ']'); i > 0 {
+			return host[:i+1]
+		}
+		return host
+	}
+	if strings.Count(host, ":") == 1 {
+		return host[:strings.IndexByte(host, ':')]
+	}
+	return host
+}
+
+// severityName returns the rule definition name of a logged severity
+func severityName(severity string) string {
+	if name, ok := severities[severity]; ok {
+		return name
+	}
+	return strings.ToLower(severity)
+}
+
+// header looks up a header case-insensitively
+func header(headers map[string]string, name string) string {
+	if v, ok := headers[name]; ok {
+		return v
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,218 @@
+package modsecurity
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"waf-admin/internal/models"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	return data
+}
+
+func ruleIDs(rules []models.WAFMatchedRule) []string {
+	ids := make([]string, len(rules))
+	for i, rule := range rules {
+		ids[i] = rule.ID
+	}
+	return ids
+}
+
+func TestParseFixtures(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    models.WAFEvent
+		rules   []string
+	}{
+		{
+			fixture: "libmodsecurity.json",
+			want: models.WAFEvent{
+				TransactionID: "171455853012.345678",
+				Timestamp:     time.Date(2024, 5, 1, 10, 15, 30, 0, time.UTC),
+				Host:          "shop.example.com",
+				URI:           "/search?q=1%27%20OR%201=1--",
+				Method:        "GET",
+				ClientIP:      "203.0.113.7",
+				ClientPort:    51234,
+				ServerIP:      "10.244.0.12",
+				ServerPort:    443,
+				Status:        403,
+				Action:        models.WAFActionBlocked,
+				AnomalyScore:  5,
+			},
+			rules: []string{"942100", "949110"},
+		},
+		{
+			fixture: "libmodsecurity-native.log",
+			want: models.WAFEvent{
+				TransactionID: "171455853012.345678",
+				Timestamp:     time.Date(2024, 5, 1, 10, 15, 30, 0, time.UTC),
+				Host:          "[2001:db8::10]",
+				URI:           "/login",
+				Method:        "POST",
+				ClientIP:      "203.0.113.7",
+				ClientPort:    51234,
+				ServerIP:      "10.244.0.12",
+				ServerPort:    443,
+				Status:        403,
+				Action:        models.WAFActionBlocked,
+				AnomalyScore:  5,
+			},
+			rules: []string{"941100", "949110", "980130"},
+		},
+		{
+			fixture: "modsecurity2-native.log",
+			want: models.WAFEvent{
+				TransactionID:        "ZjHk8n8AAQEAAGx1AAAAAAAA",
+				Timestamp:            time.Date(2024, 5, 1, 8, 15, 30, 123456000, time.UTC),
+				Host:                 "2001:db8::20",
+				URI:                  "/admin/../etc/passwd",
+				Method:               "GET",
+				ClientIP:             "198.51.100.23",
+				ClientPort:           40022,
+				ServerIP:             "10.244.0.13",
+				ServerPort:           80,
+				Status:               200,
+				Action:               models.WAFActionDetected,
+				OutboundAnomalyScore: 4,
+			},
+			rules: []string{"930120", "959100"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			event, err := Parse(readFixture(t, tt.fixture))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			got := *event
+			got.Rules, got.Request, got.Response = nil, models.WAFRequest{}, models.WAFResponse{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("event =\n  %+v\nwant\n  %+v", got, tt.want)
+			}
+			if ids := ruleIDs(event.Rules); !reflect.DeepEqual(ids, tt.rules) {
+				t.Errorf("rule IDs = %v, want %v", ids, tt.rules)
+			}
+		})
+	}
+}
+
+func TestParseNativeRuleDetails(t *testing.T) {
+	event, err := ParseNative(readFixture(t, "libmodsecurity-native.log"))
+	if err != nil {
+		t.Fatalf("ParseNative: %v", err)
+	}
+
+	want := models.WAFMatchedRule{
+		ID:       "941100",
+		Message:  "XSS Attack Detected via libinjection",
+		Match:    "Warning. detected XSS using libinjection.",
+		Data:     "Matched Data: XSS data found within ARGS:pass: <script>x</script>",
+		Severity: "critical",
+		Tags:     []string{"attack-xss", "OWASP_CRS"},
+		File:     "/etc/nginx/owasp-modsecurity-crs/rules/REQUEST-941-APPLICATION-ATTACK-XSS.conf",
+		Line:     "55",
+	}
+	if !reflect.DeepEqual(event.Rules[0], want) {
+		t.Errorf("rule =\n  %+v\nwant\n  %+v", event.Rules[0], want)
+	}
+	if event.Request.Body != "user=admin&pass=<script>x</script>" {
+		t.Errorf("request body = %q", event.Request.Body)
+	}
+	if event.Request.HTTPVersion != "1.1" || event.Request.Headers["Content-Type"] != "application/x-www-form-urlencoded" {
+		t.Errorf("request = %+v", event.Request)
+	}
+	if event.Response.Headers["Server"] != "nginx" {
+		t.Errorf("response headers = %v", event.Response.Headers)
+	}
+}
+
+func TestParseJSONRuleDetails(t *testing.T) {
+	event, err := ParseJSON(readFixture(t, "libmodsecurity.json"))
+	if err != nil {
+		t.Fatalf("ParseJSON: %v", err)
+	}
+
+	rule := event.Rules[0]
+	if rule.Severity != "critical" || rule.Line != "46" || len(rule.Tags) != 8 || rule.Message != "SQL Injection Attack Detected via libinjection" {
+		t.Errorf("rule = %+v", rule)
+	}
+	if event.Request.HTTPVersion != "1.1" || event.Request.Headers["User-Agent"] != "curl/8.5.0" {
+		t.Errorf("request = %+v", event.Request)
+	}
+}
+
+func TestAnomalyScores(t *testing.T) {
+	tests := []struct {
+		message  string
+		inbound  int
+		outbound int
+	}{
+		{message: "Inbound Anomaly Score Exceeded (Total Score: 15)", inbound: 15},
+		{message: "Inbound Anomaly Score Exceeded (Total Inbound Score: 10 - SQLI=10,XSS=0,RFI=0,LFI=0,RCE=0,PHPI=0,HTTP=0,SESS=0): individual paranoia level scores: 10, 0, 0, 0", inbound: 10},
+		{message: "Outbound Anomaly Score Exceeded (Total Score: 4)", outbound: 4},
+		{message: "Outbound Anomaly Score Exceeded (score 8): individual paranoia level scores: 8, 0, 0, 0", outbound: 8},
+		{message: "SQL Injection Attack Detected via libinjection"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			event := &models.WAFEvent{Rules: []models.WAFMatchedRule{{ID: "949110", Message: tt.message}}}
+			finish(event)
+			if event.AnomalyScore != tt.inbound || event.OutboundAnomalyScore != tt.outbound {
+				t.Errorf("scores = %d/%d, want %d/%d", event.AnomalyScore, event.OutboundAnomalyScore, tt.inbound, tt.outbound)
+			}
+		})
+	}
+
+	// The highest score wins when both blocking and reporting rules matched
+	event := &models.WAFEvent{Rules: []models.WAFMatchedRule{
+		{ID: "949110", Message: "Inbound Anomaly Score Exceeded (Total Score: 5)"},
+		{ID: "980130", Message: "Inbound Anomaly Score Exceeded (Total Inbound Score: 8 - SQLI=8)"},
+	}}
+	finish(event)
+	if event.AnomalyScore != 8 {
+		t.Errorf("AnomalyScore = %d, want 8", event.AnomalyScore)
+	}
+}
+
+func TestStripPort(t *testing.T) {
+	tests := map[string]string{
+		"example.com":          "example.com",
+		"example.com:8080":     "example.com",
+		"10.0.0.1:80":          "10.0.0.1",
+		"[2001:db8::1]:8443":   "[2001:db8::1]",
+		"[2001:db8::1]":        "[2001:db8::1]",
+		"2001:db8::1":          "2001:db8::1",
+		"::1":                  "::1",
+		"":                     "",
+		"[2001:db8::1":         "[2001:db8::1",
+		"fe80::1%eth0":         "fe80::1%eth0",
+		"shop.example.com:443": "shop.example.com",
+	}
+	for host, want := range tests {
+		if got := stripPort(host); got != want {
+			t.Errorf("stripPort(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestParseUnrecognized(t *testing.T) {
+	for _, record := range []string{"", "   ", "GET / HTTP/1.1", `{"other":1}`, "--a1b2c3d4-Z--\n"} {
+		if _, err := Parse([]byte(record)); !errors.Is(err, ErrUnrecognized) {
+			t.Errorf("Parse(%q) error = %v, want ErrUnrecognized", record, err)
+		}
+	}
+}
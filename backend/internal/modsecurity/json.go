@@ -0,0 +1,133 @@
+package modsecurity
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"waf-admin/internal/models"
+)
+
+// jsonRecord is a libmodsecurity v3 JSON audit log record
+type jsonRecord struct {
+	Transaction *struct {
+		ClientIP   string `json:"client_ip"`
+		TimeStamp  string `json:"time_stamp"`
+		ClientPort scalar `json:"client_port"`
+		HostIP     string `json:"host_ip"`
+		HostPort   scalar `json:"host_port"`
+		UniqueID   string `json:"unique_id"`
+		Request    struct {
+			Method      string            `json:"method"`
+			HTTPVersion scalar            `json:"http_version"`
+			URI         string            `json:"uri"`
+			Headers     map[string]string `json:"headers"`
+			Body        string            `json:"body"`
+		} `json:"request"`
+		Response struct {
+			HTTPCode scalar            `json:"http_code"`
+			Headers  map[string]string `json:"headers"`
+			Body     string            `json:"body"`
+		} `json:"response"`
+		Producer struct {
+			SecRulesEngine string `json:"secrules_engine"`
+		} `json:"producer"`
+		Messages []struct {
+			Message string `json:"message"`
+			Details struct {
+				Match      string   `json:"match"`
+				RuleID     string   `json:"ruleId"`
+				File       string   `json:"file"`
+				LineNumber string   `json:"lineNumber"`
+				Data       string   `json:"data"`
+				Severity   string   `json:"severity"`
+				Tags       []string `json:"tags"`
+			} `json:"details"`
+		} `json:"messages"`
+	} `json:"transaction"`
+}
+
+// scalar decodes a JSON string or number as its text, since the types of
+// some fields differ between libmodsecurity versions
+type scalar string
+
+func (v *scalar) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = scalar(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*v = scalar(n)
+	return nil
+}
+
+// ParseJSON parses a record written with SecAuditLogFormat JSON
+func ParseJSON(record []byte) (*models.WAFEvent, error) {
+	var r jsonRecord
+	if err := json.Unmarshal(record, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON audit record: %w", err)
+	}
+	tx := r.Transaction
+	if tx == nil {
+		return nil, ErrUnrecognized
+	}
+
+	status, _ := strconv.Atoi(string(tx.Response.HTTPCode))
+	event := &models.WAFEvent{
+		TransactionID: tx.UniqueID,
+		ClientIP:      tx.ClientIP,
+		ServerIP:      tx.HostIP,
+		Request: models.WAFRequest{
+			Method:      tx.Request.Method,
+			URI:         tx.Request.URI,
+			HTTPVersion: string(tx.Request.HTTPVersion),
+			Headers:     tx.Request.Headers,
+			Body:        tx.Request.Body,
+		},
+		Response: models.WAFResponse{
+			Status:  status,
+			Headers: tx.Response.Headers,
+			Body:    tx.Response.Body,
+		},
+	}
+	event.ClientPort, _ = strconv.Atoi(string(tx.ClientPort))
+	event.ServerPort, _ = strconv.Atoi(string(tx.HostPort))
+	// libmodsecurity writes the time in ctime format without a zone;
+	// ingress-nginx runs in UTC
+	if t, err := time.Parse(time.ANSIC, tx.TimeStamp); err == nil {
+		event.Timestamp = t.UTC()
+	}
+
+	for _, m := range tx.Messages {
+		event.Rules = append(event.Rules, models.WAFMatchedRule{
+			ID:       m.Details.RuleID,
+			Message:  m.Message,
+			Match:    m.Details.Match,
+			Data:     m.Details.Data,
+			Severity: severityName(m.Details.Severity),
+			Tags:     m.Details.Tags,
+			File:     m.Details.File,
+			Line:     m.Details.LineNumber,
+		})
+	}
+
+	// The JSON format does not record the disruptive action. A rule that
+	// matched while the engine was enabled and an error response is taken
+	// as an intervention.
+	switch {
+	case len(event.Rules) == 0:
+		event.Action = models.WAFActionPassed
+	case tx.Producer.SecRulesEngine != "DetectionOnly" && status >= 400:
+		event.Action = models.WAFActionBlocked
+	default:
+		event.Action = models.WAFActionDetected
+	}
+
+	finish(event)
+	return event, nil
+}
@@ -0,0 +1,188 @@
+package modsecurity
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"waf-admin/internal/models"
+)
+
+// Native records are split into sections by boundary lines, "---<id>---A--"
+// for libmodsecurity and "--<id>-A--" for ModSecurity 2
+var boundaryPattern = regexp.MustCompile(`^-{2,3}[A-Za-z0-9]+-{1,3}([A-Z])--$`)
+
+// messageTagPattern matches the bracketed tags of a rule message, such as
+// [id "942100"]
+var messageTagPattern = regexp.MustCompile(`\[(\w+) "((?:[^"\\]|\\.)*)"\]`)
+
+// nativeTimeLayout is the timestamp of section A. ModSecurity 2 adds
+// fractional seconds, which time.Parse accepts without them in the layout.
+const nativeTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// ParseNative parses a record written in the native serial format. Only
+// the sections needed for an event are read: A (transaction), B (request
+// headers), C (request body), E (response body), F (response headers) and
+// H (rule messages).
+func ParseNative(record []byte) (*models.WAFEvent, error) {
+	sections := map[byte][]string{}
+	var current byte
+	scanner := bufio.NewScanner(bytes.NewReader(record))
+	scanner.Buffer(make([]byte, 64*1024), len(record)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if m := boundaryPattern.FindStringSubmatch(line); m != nil {
+			current = m[1][0]
+			sections[current] = []string{}
+			continue
+		}
+		if current != 0 {
+			sections[current] = append(sections[current], line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := sections['A']; !ok {
+		return nil, ErrUnrecognized
+	}
+
+	event := &models.WAFEvent{Action: models.WAFActionPassed}
+	parseNativeTransaction(event, sections['A'])
+	event.Request.Method, event.Request.URI, event.Request.HTTPVersion, event.Request.Headers = parseNativeHead(sections['B'])
+	event.Request.Body = strings.Join(sections['C'], "\n")
+	_, status, _, headers := parseNativeHead(sections['F'])
+	event.Response.Status, _ = strconv.Atoi(status)
+	event.Response.Headers = headers
+	event.Response.Body = strings.Join(sections['E'], "\n")
+
+	for _, line := range sections['H'] {
+		var message string
+		switch {
+		case strings.HasPrefix(line, "ModSecurity: "):
+			message = strings.TrimPrefix(line, "ModSecurity: ")
+		case strings.HasPrefix(line, "Message: "):
+			message = strings.TrimPrefix(line, "Message: ")
+		case strings.HasPrefix(line, "Action: Intercepted"):
+			event.Action = models.WAFActionBlocked
+			continue
+		default:
+			continue
+		}
+		rule := parseNativeMessage(message)
+		if rule.ID == "" {
+			continue
+		}
+		event.Rules = append(event.Rules, rule)
+		if strings.HasPrefix(message, "Access denied") {
+			event.Action = models.WAFActionBlocked
+		} else if event.Action == models.WAFActionPassed {
+			event.Action = models.WAFActionDetected
+		}
+	}
+
+	finish(event)
+	return event, nil
+}
+
+// parseNativeTransaction reads section A:
+// [timestamp] unique_id client_ip client_port server_ip server_port
+func parseNativeTransaction(event *models.WAFEvent, lines []string) {
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "[") {
+			continue
+		}
+		end := strings.IndexByte(line, ']')
+		if end < 0 {
+			return
+		}
+		if t, err := time.Parse(nativeTimeLayout, line[1:end]); err == nil {
+			event.Timestamp = t.UTC()
+		}
+		fields := strings.Fields(line[end+1:])
+		if len(fields) > 0 {
+			event.TransactionID = fields[0]
+		}
+		if len(fields) > 1 {
+			event.ClientIP = fields[1]
+		}
+		if len(fields) > 2 {
+			event.ClientPort, _ = strconv.Atoi(fields[2])
+		}
+		if len(fields) > 3 {
+			event.ServerIP = fields[3]
+		}
+		if len(fields) > 4 {
+			event.ServerPort, _ = strconv.Atoi(fields[4])
+		}
+		return
+	}
+}
+
+// parseNativeHead reads the start line and headers of section B or F. The
+// three start line parts are method, URI and version for a request, and
+// version, status and reason for a response.
+func parseNativeHead(lines []string) (first, second, third string, headers map[string]string) {
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, " ", 3)
+		first = parts[0]
+		if len(parts) > 1 {
+			second = parts[1]
+		}
+		if len(parts) > 2 {
+			third = parts[2]
+		}
+		// A response start line is "HTTP/1.1 403 Forbidden"; the request
+		// version goes last
+		if !strings.HasPrefix(first, "HTTP/") {
+			third = strings.TrimPrefix(third, "HTTP/")
+		}
+		for _, h := range lines[i+1:] {
+			name, value, ok := strings.Cut(h, ":")
+			if !ok {
+				continue
+			}
+			if headers == nil {
+				headers = map[string]string{}
+			}
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+		return
+	}
+	return
+}
+
+// parseNativeMessage reads one rule message: the match description followed
+// by bracketed tags
+func parseNativeMessage(message string) models.WAFMatchedRule {
+	rule := models.WAFMatchedRule{Match: message}
+	if loc := messageTagPattern.FindStringIndex(message); loc != nil {
+		rule.Match = strings.TrimSpace(message[:loc[0]])
+	}
+	for _, m := range messageTagPattern.FindAllStringSubmatch(message, -1) {
+		value := strings.ReplaceAll(m[2], `\"`, `"`)
+		switch m[1] {
+		case "id":
+			rule.ID = value
+		case "msg":
+			rule.Message = value
+		case "data":
+			rule.Data = value
+		case "severity":
+			rule.Severity = severityName(value)
+		case "tag":
+			rule.Tags = append(rule.Tags, value)
+		case "file":
+			rule.File = value
+		case "line":
+			rule.Line = value
+		}
+	}
+	return rule
+}
@@ -0,0 +1,445 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"waf-admin/internal/auth"
+	"waf-admin/internal/config"
+	"waf-admin/internal/k8s"
+	"waf-admin/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	ErrAlertRuleNotFound = errors.New("alert rule not found")
+	ErrInvalidAlertRule  = errors.New("invalid alert rule")
+	ErrAlertRuleConflict = errors.New("alert rules were modified concurrently, retry the request")
+)
+
+// The managed rules ConfigMap holds the rules with their admin metadata as
+// JSON, and the enabled rules rendered as a vmalert rule file. vmalert only
+// loads the *.yaml key.
+const (
+	alertRulesStoreKey = "rules.json"
+	alertRulesFileKey  = "waf-admin-rules.yaml"
+)
+
+// identifierPattern matches valid alert and label names
+var identifierPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// AlertRulesService manages the alert rules created through the API. Rules
+// are stored in a ConfigMap that vmalert mounts; every change validates the
+// expression against VictoriaMetrics first. vmalert is not asked to reload:
+// the kubelet syncs the mounted file up to a minute or so later, and vmalert
+// re-reads it every -configCheckInterval.
+type AlertRulesService struct {
+	k8sClient     *k8s.Client
+	alertsService *AlertsService
+	config        atomic.Pointer[config.Config]
+	logger        *logrus.Logger
+	vmClient      *http.Client
+	auditService  *AuditService
+
+	// mutex serializes changes from this replica; the ConfigMap's
+	// resourceVersion guards against writes from other replicas
+	mutex sync.Mutex
+}
+
+func NewAlertRulesService(k8sClient *k8s.Client, alertsService *AlertsService, cfg *config.Config, logger *logrus.Logger) *AlertRulesService {
+	s := &AlertRulesService{
+		k8sClient:     k8sClient,
+		alertsService: alertsService,
+		logger:        logger,
+		vmClient:      newUpstreamClient(upstreamVictoriaMetrics),
+	}
+	s.config.Store(cfg)
+	return s
+}
+
+// UpdateConfig swaps in a reloaded configuration
+func (s *AlertRulesService) UpdateConfig(cfg *config.Config) {
+	s.config.Store(cfg)
+}
+
+func (s *AlertRulesService) SetAuditService(auditService *AuditService) {
+	s.auditService = auditService
+}
+
+// ListRules returns the managed rules together with the other alerting rules
+// vmalert has loaded. Managed rules carry vmalert's state when it has loaded
+// them, or "disabled". When vmalert is unreachable only the managed rules
+// are returned.
+func (s *AlertRulesService) ListRules(ctx context.Context, filter models.AlertFilter) ([]models.AlertRule, error) {
+	_, managed, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	group := s.config.Load().Metrics.AlertRules.Group
+	byName := make(map[string]int, len(managed))
+	for i := range managed {
+		managed[i].Managed = true
+		managed[i].Group = group
+		if !managed[i].Enabled {
+			managed[i].State = "disabled"
+		}
+		byName[managed[i].Name] = i
+	}
+
+	loaded, err := s.alertsService.GetAlertRules(ctx, models.AlertFilter{})
+	if err != nil {
+		s.logger.Warnf("Failed to get alert rules from vmalert, listing managed rules only: %v", err)
+	}
+
+	var unmanaged []models.AlertRule
+	for _, r := range loaded {
+		if i, ok := byName[r.Name]; ok && r.Group == group {
+			// vmalert may still report a rule disabled moments ago
+			if managed[i].Enabled {
+				managed[i].State = r.State
+				managed[i].Health = r.Health
+				managed[i].LastError = r.LastError
+			}
+			continue
+		}
+		unmanaged = append(unmanaged, r)
+	}
+	rules := append(managed, unmanaged...)
+
+	filtered := rules[:0]
+	for _, r := range rules {
+		if matchesAlertFilter(models.AlertFilter{State: filter.State, Severity: filter.Severity}, r.State, r.Labels) {
+			filtered = append(filtered, r)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		if filtered[i].Group != filtered[j].Group {
+			return filtered[i].Group < filtered[j].Group
+		}
+		return filtered[i].Name < filtered[j].Name
+	})
+	return filtered, nil
+}
+
+// CreateRule adds a managed rule, enabled unless the request says otherwise
+func (s *AlertRulesService) CreateRule(ctx context.Context, req models.AlertRuleRequest) (*models.AlertRule, error) {
+	if err := s.validate(ctx, req); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	configMap, rules, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		if r.Name == req.Name {
+			return nil, fmt.Errorf("%w: a rule named %q already exists", ErrInvalidAlertRule, req.Name)
+		}
+	}
+
+	now := time.Now()
+	rule := models.AlertRule{
+		ID:        uuid.New().String(),
+		Enabled:   true,
+		CreatedAt: now,
+	}
+	applyAlertRuleRequest(&rule, req, now)
+	rules = append(rules, rule)
+
+	return &rule, s.save(ctx, configMap, rules, "CREATE_ALERT_RULE", rule.ID, nil, rule)
+}
+
+// UpdateRule replaces the definition of a managed rule
+func (s *AlertRulesService) UpdateRule(ctx context.Context, id string, req models.AlertRuleRequest) (*models.AlertRule, error) {
+	if err := s.validate(ctx, req); err != nil {
+		return nil, err
+	}
+
+	return s.modify(ctx, id, "UPDATE_ALERT_RULE", func(rules []models.AlertRule, rule *models.AlertRule) error {
+		for _, r := range rules {
+			if r.Name == req.Name && r.ID != id {
+				return fmt.Errorf("%w: a rule named %q already exists", ErrInvalidAlertRule, req.Name)
+			}
+		}
+		applyAlertRuleRequest(rule, req, time.Now())
+		return nil
+	})
+}
+
+// SetRuleEnabled enables or disables a managed rule. Disabled rules are kept
+// in the ConfigMap but left out of the rule file vmalert loads.
+func (s *AlertRulesService) SetRuleEnabled(ctx context.Context, id string, enabled bool) (*models.AlertRule, error) {
+	action := "DISABLE_ALERT_RULE"
+	if enabled {
+		action = "ENABLE_ALERT_RULE"
+	}
+	return s.modify(ctx, id, action, func(_ []models.AlertRule, rule *models.AlertRule) error {
+		rule.Enabled = enabled
+		rule.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// DeleteRule removes a managed rule
+func (s *AlertRulesService) DeleteRule(ctx context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	configMap, rules, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	for i, r := range rules {
+		if r.ID == id {
+			rules = append(rules[:i], rules[i+1:]...)
+			return s.save(ctx, configMap, rules, "DELETE_ALERT_RULE", id, r, nil)
+		}
+	}
+	return ErrAlertRuleNotFound
+}
+
+// modify applies change to the rule with the given ID and saves the result
+func (s *AlertRulesService) modify(ctx context.Context, id, action string, change func(rules []models.AlertRule, rule *models.AlertRule) error) (*models.AlertRule, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	configMap, rules, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		if rules[i].ID != id {
+			continue
+		}
+		old := rules[i]
+		if err := change(rules, &rules[i]); err != nil {
+			return nil, err
+		}
+		rule := rules[i]
+		return &rule, s.save(ctx, configMap, rules, action, id, old, rule)
+	}
+	return nil, ErrAlertRuleNotFound
+}
+
+func applyAlertRuleRequest(rule *models.AlertRule, req models.AlertRuleRequest, now time.Time) {
+	rule.Managed = true
+	rule.Name = req.Name
+	rule.Expression = strings.TrimSpace(req.Expression)
+	rule.For = req.For
+	rule.Labels = nonNilMap(req.Labels)
+	rule.Annotations = nonNilMap(req.Annotations)
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	rule.UpdatedAt = now
+}
+
+// validate checks a rule request locally, then asks VictoriaMetrics to
+// evaluate the expression so syntax errors are reported before vmalert
+// rejects the whole rule file
+func (s *AlertRulesService) validate(ctx context.Context, req models.AlertRuleRequest) error {
+	if !identifierPattern.MatchString(req.Name) {
+		return fmt.Errorf("%w: name must match %s", ErrInvalidAlertRule, identifierPattern)
+	}
+	if strings.TrimSpace(req.Expression) == "" {
+		return fmt.Errorf("%w: expression must not be empty", ErrInvalidAlertRule)
+	}
+	if req.For != "" {
+		if d, err := time.ParseDuration(req.For); err != nil || d < 0 {
+			return fmt.Errorf("%w: for must be a duration such as 5m, got %q", ErrInvalidAlertRule, req.For)
+		}
+	}
+	for name := range req.Labels {
+		if !identifierPattern.MatchString(name) {
+			return fmt.Errorf("%w: invalid label name %q", ErrInvalidAlertRule, name)
+		}
+	}
+	for name := range req.Annotations {
+		if !identifierPattern.MatchString(name) {
+			return fmt.Errorf("%w: invalid annotation name %q", ErrInvalidAlertRule, name)
+		}
+	}
+
+	return s.validateExpression(ctx, strings.TrimSpace(req.Expression))
+}
+
+func (s *AlertRulesService) validateExpression(ctx context.Context, expr string) error {
+	u, err := url.Parse(s.config.Load().Metrics.VictoriaMetricsURL + "/api/v1/query")
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("query", expr)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.vmClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to validate expression: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		var result VMQueryResult
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&result); err != nil || result.Error == "" {
+			return fmt.Errorf("%w: expression rejected by VictoriaMetrics", ErrInvalidAlertRule)
+		}
+		return fmt.Errorf("%w: %s", ErrInvalidAlertRule, result.Error)
+	default:
+		return fmt.Errorf("failed to validate expression: victoria metrics returned status %d", resp.StatusCode)
+	}
+}
+
+// load reads the managed rules. A missing ConfigMap is returned as a new,
+// unsaved object with no rules.
+func (s *AlertRulesService) load(ctx context.Context) (*corev1.ConfigMap, []models.AlertRule, error) {
+	namespace, name := s.ConfigMapRef()
+	configMap, err := s.k8sClient.GetConfigMap(ctx, namespace, name)
+	if apierrors.IsNotFound(err) {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					"app": "waf-admin",
+				},
+			},
+		}, []models.AlertRule{}, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get alert rules configmap: %w", err)
+	}
+
+	rules := []models.AlertRule{}
+	if data := configMap.Data[alertRulesStoreKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &rules); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode alert rules: %w", err)
+		}
+	}
+	return configMap, rules, nil
+}
+
+// save writes the rules and the rendered rule file, records the change in
+// the audit log and reloads vmalert
+func (s *AlertRulesService) save(ctx context.Context, configMap *corev1.ConfigMap, rules []models.AlertRule, action, id string, oldValue, newValue interface{}) error {
+	store, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert rules: %w", err)
+	}
+	ruleFile, err := s.renderRuleFile(rules)
+	if err != nil {
+		return fmt.Errorf("failed to render alert rules: %w", err)
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[alertRulesStoreKey] = string(store)
+	configMap.Data[alertRulesFileKey] = string(ruleFile)
+
+	if configMap.ResourceVersion == "" {
+		_, err = s.k8sClient.CreateConfigMap(ctx, configMap.Namespace, configMap)
+	} else {
+		err = s.k8sClient.UpdateConfigMap(ctx, configMap.Namespace, configMap)
+	}
+	if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+		return ErrAlertRuleConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save alert rules configmap: %w", err)
+	}
+
+	if s.auditService != nil {
+		user := "system"
+		if u, ok := auth.UserFromContext(ctx); ok && u.Name != "" {
+			user = u.Name
+		}
+		auditLog := s.auditService.CreateAuditLog(action, "alert_rule", id, user, "", "", oldValue, newValue)
+		if err := s.auditService.LogChange(ctx, auditLog); err != nil {
+			s.logger.Warnf("Failed to log audit change: %v", err)
+		}
+	}
+	return nil
+}
+
+// vmalert rule file format
+type ruleFile struct {
+	Groups []ruleFileGroup `yaml:"groups"`
+}
+
+type ruleFileGroup struct {
+	Name  string         `yaml:"name"`
+	Rules []ruleFileRule `yaml:"rules"`
+}
+
+type ruleFileRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// renderRuleFile writes the enabled rules, sorted by name, as one vmalert
+// group. With no enabled rules the file has no groups, since vmalert
+// rejects empty groups.
+func (s *AlertRulesService) renderRuleFile(rules []models.AlertRule) ([]byte, error) {
+	group := ruleFileGroup{Name: s.config.Load().Metrics.AlertRules.Group}
+	for _, r := range rules {
+		if !r.Enabled {
+			continue
+		}
+		group.Rules = append(group.Rules, ruleFileRule{
+			Alert:       r.Name,
+			Expr:        r.Expression,
+			For:         r.For,
+			Labels:      r.Labels,
+			Annotations: r.Annotations,
+		})
+	}
+	sort.Slice(group.Rules, func(i, j int) bool { return group.Rules[i].Alert < group.Rules[j].Alert })
+
+	file := ruleFile{Groups: []ruleFileGroup{}}
+	if len(group.Rules) > 0 {
+		file.Groups = append(file.Groups, group)
+	}
+	return yaml.Marshal(file)
+}
+
+// ConfigMapRef returns the namespace and name of the alert rules ConfigMap
+func (s *AlertRulesService) ConfigMapRef() (namespace, name string) {
+	cfg := s.config.Load()
+	namespace = cfg.Metrics.AlertRules.Namespace
+	if namespace == "" {
+		namespace = cfg.Kubernetes.Namespace
+	}
+	return namespace, cfg.Metrics.AlertRules.ConfigMapName
+}
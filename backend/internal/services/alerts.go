@@ -0,0 +1,368 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"waf-admin/internal/config"
+	"waf-admin/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrAlertNotFound = errors.New("alert not found")
+	// ErrAlertsUnavailable is returned when vmalert cannot be queried
+	ErrAlertsUnavailable = errors.New("failed to get alerts from vmalert")
+)
+
+// Alert states reported by vmalert. Rules are "inactive" while their
+// expression returns nothing; active alerts are "pending" until their "for"
+// duration has passed and "firing" after that. Managed rules that are
+// switched off are "disabled".
+var (
+	alertStates = []string{"firing", "pending"}
+	ruleStates  = []string{"firing", "pending", "inactive", "disabled"}
+)
+
+// AlertsService reads active alerts and alerting rules from vmalert
+type AlertsService struct {
+	config atomic.Pointer[config.Config]
+	logger *logrus.Logger
+	client *http.Client
+
+	silencesService *SilencesService
+}
+
+func NewAlertsService(cfg *config.Config, logger *logrus.Logger) *AlertsService {
+	s := &AlertsService{
+		logger: logger,
+		client: newUpstreamClient(upstreamVmalert),
+	}
+	s.config.Store(cfg)
+	return s
+}
+
+// UpdateConfig swaps in a reloaded configuration
+func (s *AlertsService) UpdateConfig(cfg *config.Config) {
+	s.config.Store(cfg)
+}
+
+// SetSilencesService enables muting alerts with silences
+func (s *AlertsService) SetSilencesService(silencesService *SilencesService) {
+	s.silencesService = silencesService
+}
+
+// ValidateAlertFilter checks the state of a filter for alerts or, when
+// rules is set, for rules
+func ValidateAlertFilter(filter models.AlertFilter, rules bool) error {
+	states := alertStates
+	if rules {
+		states = ruleStates
+	}
+	if filter.State == "" {
+		return nil
+	}
+	for _, state := range states {
+		if filter.State == state {
+			return nil
+		}
+	}
+	return fmt.Errorf("state must be one of %s", strings.Join(states, ", "))
+}
+
+// GetAlerts returns the active alerts matching filter, firing alerts first
+// and the most recent first within each state. Alerts muted by an active
+// silence are left out unless filter.IncludeSilenced is set. If silences
+// cannot be read, every alert is returned unmuted.
+func (s *AlertsService) GetAlerts(ctx context.Context, filter models.AlertFilter) ([]models.Alert, error) {
+	var data struct {
+		Alerts []vmalertAlert `json:"alerts"`
+	}
+	if err := s.get(ctx, "/api/v1/alerts", &data); err != nil {
+		return nil, err
+	}
+
+	var silences []models.Silence
+	var acks map[string]models.AlertAcknowledgement
+	if s.silencesService != nil {
+		var err error
+		if silences, err = s.silencesService.ActiveSilences(ctx); err != nil {
+			s.logger.Warnf("Failed to get silences, returning alerts unmuted: %v", err)
+		}
+		if acks, err = s.silencesService.Acknowledgements(ctx); err != nil {
+			s.logger.Warnf("Failed to get alert acknowledgements: %v", err)
+		}
+	}
+
+	alerts := make([]models.Alert, 0, len(data.Alerts))
+	for _, a := range data.Alerts {
+		if !matchesAlertFilter(filter, a.State, a.Labels) {
+			continue
+		}
+		alert := a.toModel()
+		if len(silences) > 0 {
+			alert.SilencedBy = silencedBy(silences, alertLabels(alert))
+			alert.Silenced = len(alert.SilencedBy) > 0
+		}
+		if alert.Silenced && !filter.IncludeSilenced {
+			continue
+		}
+		if ack, ok := acks[alert.ID]; ok && ack.AlertStartsAt.Equal(alert.StartsAt) {
+			alert.Acknowledgement = &ack
+		}
+		alerts = append(alerts, alert)
+	}
+
+	sort.SliceStable(alerts, func(i, j int) bool {
+		if alerts[i].State != alerts[j].State {
+			return alerts[i].State == "firing"
+		}
+		return alerts[i].StartsAt.After(alerts[j].StartsAt)
+	})
+	return alerts, nil
+}
+
+// AcknowledgeAlert records that the requesting user is handling the active
+// alert with req.AlertID. Acknowledging it again replaces the comment.
+func (s *AlertsService) AcknowledgeAlert(ctx context.Context, req models.AcknowledgementRequest) (*models.AlertAcknowledgement, error) {
+	if s.silencesService == nil {
+		return nil, fmt.Errorf("alert acknowledgements are not available")
+	}
+	active, err := s.activeAlerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, alert := range active {
+		if alert.ID != req.AlertID {
+			continue
+		}
+		ack := models.AlertAcknowledgement{
+			AlertID:        alert.ID,
+			AlertName:      alert.Name,
+			AlertStartsAt:  alert.StartsAt,
+			AcknowledgedBy: s.silencesService.auditUser(ctx),
+			AcknowledgedAt: time.Now(),
+			Comment:        strings.TrimSpace(req.Comment),
+		}
+		if err := s.silencesService.acknowledge(ctx, ack, active); err != nil {
+			return nil, err
+		}
+		return &ack, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrAlertNotFound, req.AlertID)
+}
+
+// UnacknowledgeAlert removes the acknowledgement of an active alert
+func (s *AlertsService) UnacknowledgeAlert(ctx context.Context, alertID string) error {
+	if s.silencesService == nil {
+		return ErrAcknowledgementNotFound
+	}
+	active, err := s.activeAlerts(ctx)
+	if err != nil {
+		return err
+	}
+	return s.silencesService.unacknowledge(ctx, alertID, active)
+}
+
+// activeAlerts returns every alert vmalert reports, unfiltered
+func (s *AlertsService) activeAlerts(ctx context.Context) ([]models.Alert, error) {
+	var data struct {
+		Alerts []vmalertAlert `json:"alerts"`
+	}
+	if err := s.get(ctx, "/api/v1/alerts", &data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAlertsUnavailable, err)
+	}
+	alerts := make([]models.Alert, 0, len(data.Alerts))
+	for _, a := range data.Alerts {
+		alerts = append(alerts, a.toModel())
+	}
+	return alerts, nil
+}
+
+// GetAlertRules returns the alerting rules vmalert has loaded that match
+// filter, ordered by group and name. Recording rules are skipped. The host
+// filter does not apply to rules, which are rarely scoped to one host.
+func (s *AlertsService) GetAlertRules(ctx context.Context, filter models.AlertFilter) ([]models.AlertRule, error) {
+	var data struct {
+		Groups []struct {
+			Name  string        `json:"name"`
+			Rules []vmalertRule `json:"rules"`
+		} `json:"groups"`
+	}
+	if err := s.get(ctx, "/api/v1/rules", &data); err != nil {
+		return nil, err
+	}
+
+	rules := []models.AlertRule{}
+	for _, group := range data.Groups {
+		for _, r := range group.Rules {
+			if r.Type != "alerting" {
+				continue
+			}
+			if !matchesAlertFilter(models.AlertFilter{State: filter.State, Severity: filter.Severity}, r.State, r.Labels) {
+				continue
+			}
+			rules = append(rules, r.toModel(group.Name))
+		}
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Group != rules[j].Group {
+			return rules[i].Group < rules[j].Group
+		}
+		return rules[i].Name < rules[j].Name
+	})
+	return rules, nil
+}
+
+// alertLabels returns the labels silences are matched against, including
+// alertname as Alertmanager sees it
+func alertLabels(alert models.Alert) map[string]string {
+	if _, ok := alert.Labels["alertname"]; ok {
+		return alert.Labels
+	}
+	labels := make(map[string]string, len(alert.Labels)+1)
+	for k, v := range alert.Labels {
+		labels[k] = v
+	}
+	labels["alertname"] = alert.Name
+	return labels
+}
+
+func matchesAlertFilter(filter models.AlertFilter, state string, labels map[string]string) bool {
+	if filter.State != "" && state != filter.State {
+		return false
+	}
+	if filter.Severity != "" && !strings.EqualFold(labels["severity"], filter.Severity) {
+		return false
+	}
+	if filter.Host != "" && !strings.EqualFold(labels["host"], filter.Host) {
+		return false
+	}
+	return true
+}
+
+// get calls a vmalert API endpoint and decodes the data field of its
+// Prometheus-style response into out
+func (s *AlertsService) get(ctx context.Context, path string, out interface{}) error {
+	baseURL := s.config.Load().Metrics.VmalertURL
+	if baseURL == "" {
+		return fmt.Errorf("metrics.vmalert_url is not configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(baseURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("vmalert returned status %d: %s", resp.StatusCode, body)
+	}
+
+	var result struct {
+		Status string          `json:"status"`
+		Error  string          `json:"error"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode vmalert response: %w", err)
+	}
+	if result.Status != "success" {
+		return fmt.Errorf("vmalert request failed: %s", result.Error)
+	}
+	return json.Unmarshal(result.Data, out)
+}
+
+// vmalertAlert is an active alert as returned by vmalert's /api/v1/alerts
+type vmalertAlert struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	State       string            `json:"state"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	ActiveAt    time.Time         `json:"activeAt"`
+	Source      string            `json:"source"`
+}
+
+func (a vmalertAlert) toModel() models.Alert {
+	return models.Alert{
+		ID:           a.ID,
+		Name:         a.Name,
+		State:        a.State,
+		Labels:       nonNilMap(a.Labels),
+		Annotations:  nonNilMap(a.Annotations),
+		StartsAt:     a.ActiveAt,
+		GeneratorURL: a.Source,
+	}
+}
+
+// vmalertRule is a rule as returned by vmalert's /api/v1/rules. Duration is
+// the rule's "for" in seconds.
+type vmalertRule struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Type        string            `json:"type"`
+	State       string            `json:"state"`
+	Query       string            `json:"query"`
+	Duration    float64           `json:"duration"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	Health      string            `json:"health"`
+	LastError   string            `json:"lastError"`
+}
+
+func (r vmalertRule) toModel(group string) models.AlertRule {
+	rule := models.AlertRule{
+		ID:          r.ID,
+		Name:        r.Name,
+		Expression:  r.Query,
+		Labels:      nonNilMap(r.Labels),
+		Annotations: nonNilMap(r.Annotations),
+		Enabled:     true,
+		Group:       group,
+		State:       r.State,
+		Health:      r.Health,
+		LastError:   r.LastError,
+	}
+	if r.Duration > 0 {
+		rule.For = shortDuration(time.Duration(math.Round(r.Duration)) * time.Second)
+	}
+	return rule
+}
+
+// shortDuration formats d the way rule files write it, e.g. "5m" rather
+// than "5m0s"
+func shortDuration(d time.Duration) string {
+	str := d.String()
+	if strings.HasSuffix(str, "m0s") {
+		str = strings.TrimSuffix(str, "0s")
+	}
+	if strings.HasSuffix(str, "h0m") {
+		str = strings.TrimSuffix(str, "0m")
+	}
+	return str
+}
+
+func nonNilMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
@@ -14,7 +14,8 @@ import (
 )
 
 type AuditService struct {
-	logger *logrus.Logger
+	logger   *logrus.Logger
+	notifier *Notifier
 }
 
 func NewAuditService(cfg *config.Config, logger *logrus.Logger) *AuditService {
@@ -23,6 +24,11 @@ func NewAuditService(cfg *config.Config, logger *logrus.Logger) *AuditService {
 	}
 }
 
+// SetNotifier sends every logged change to the webhook notifier
+func (s *AuditService) SetNotifier(notifier *Notifier) {
+	s.notifier = notifier
+}
+
 func (s *AuditService) LogChange(ctx context.Context, auditLog models.AuditLog) error {
 	// Generate unique ID if not provided
 	if auditLog.ID == "" {
@@ -46,6 +52,10 @@ func (s *AuditService) LogChange(ctx context.Context, auditLog models.AuditLog)
 		"audit_data": string(auditJSON),
 	}).Info("WAF Audit Log")
 
+	if s.notifier != nil {
+		s.notifier.NotifyAudit(auditLog)
+	}
+
 	return nil
 }
 
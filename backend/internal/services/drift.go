@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"waf-admin/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gopkg.in/yaml.v3"
+)
+
+var policiesDrifted = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "waf_admin_policies_drifted",
+	Help: "Policies whose Ingress or controller ConfigMap differed from the applied policy at the last drift check.",
+})
+
+// policyDrift is one policy whose applied objects were changed outside
+// waf-admin
+type policyDrift struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// WatchDrift compares applied policies with their Ingresses and the
+// controller ConfigMap every kubernetes.drift_check_interval until ctx is
+// cancelled, and sends a drift_detected event when a policy starts to
+// differ or differs in a new way. Policies changed but not applied since
+// are not compared, see k8s.Client.IngressDrift.
+func (s *WAFService) WatchDrift(ctx context.Context) {
+	reported := map[string]string{}
+
+	for {
+		interval := s.config.Load().Kubernetes.DriftCheckInterval
+		wait := interval
+		if wait <= 0 {
+			wait = time.Minute
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if interval <= 0 {
+			reported = map[string]string{}
+			policiesDrifted.Set(0)
+			continue
+		}
+
+		drifts, err := s.checkDrift(ctx)
+		if err != nil {
+			s.logger.Warnf("Failed to check policy drift: %v", err)
+			continue
+		}
+		policiesDrifted.Set(float64(len(drifts)))
+
+		current := make(map[string]string, len(drifts))
+		for _, drift := range drifts {
+			current[drift.Key] = drift.Reason
+			if reported[drift.Key] != drift.Reason {
+				s.notifyDrift(drift)
+			}
+		}
+		reported = current
+	}
+}
+
+func (s *WAFService) checkDrift(ctx context.Context) ([]policyDrift, error) {
+	configMap, err := s.k8sClient.GetWAFPolicyConfigMap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get WAF policy configmap: %w", err)
+	}
+	policies := map[string]models.WAFPolicy{}
+	if data, exists := configMap.Data["policies.yaml"]; exists && data != "{}" {
+		if err := yaml.Unmarshal([]byte(data), &policies); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal policies: %w", err)
+		}
+	}
+
+	var drifts []policyDrift
+	for key, policy := range policies {
+		if key == "global" {
+			continue
+		}
+		reason, err := s.k8sClient.IngressDrift(ctx, policy)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			drifts = append(drifts, policyDrift{Key: key, Reason: reason})
+		}
+	}
+
+	key, reason, err := s.k8sClient.ControllerDrift(ctx, policies)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		drifts = append(drifts, policyDrift{Key: key, Reason: reason})
+	}
+	return drifts, nil
+}
+
+func (s *WAFService) notifyDrift(drift policyDrift) {
+	s.logger.Warnf("WAF policy %s drifted: %s", drift.Key, drift.Reason)
+	if s.notifier == nil {
+		return
+	}
+	event := models.NotificationEvent{
+		Type:     models.EventDriftDetected,
+		Severity: "warning",
+		Title:    "WAF policy drift detected: " + drift.Key,
+		Message:  drift.Reason + "; apply the policy again to restore it",
+		Details:  drift,
+	}
+	// Policy keys are namespace/host
+	if i := strings.LastIndex(drift.Key, "/"); i >= 0 {
+		event.Host = drift.Key[i+1:]
+	}
+	s.notifier.Notify(event)
+}
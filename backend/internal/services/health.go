@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"waf-admin/internal/cache"
+	"waf-admin/internal/config"
+	"waf-admin/internal/k8s"
+	"waf-admin/internal/models"
+
+	"github.com/sirupsen/logrus"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+// HealthService probes the backend's dependencies for the readiness check.
+// The Kubernetes API and RBAC on the policy and controller ConfigMaps are
+// critical since no policy can be read or applied without them;
+// VictoriaMetrics and VictoriaLogs only back the dashboards.
+type HealthService struct {
+	k8sClient   *k8s.Client
+	config      atomic.Pointer[config.Config]
+	logger      *logrus.Logger
+	vmClient    *http.Client
+	logsClient  *http.Client
+	reportCache *cache.Cache[*models.ReadinessReport]
+}
+
+func NewHealthService(k8sClient *k8s.Client, cfg *config.Config, logger *logrus.Logger) *HealthService {
+	s := &HealthService{
+		k8sClient:   k8sClient,
+		logger:      logger,
+		vmClient:    newUpstreamClient(upstreamVictoriaMetrics),
+		logsClient:  newUpstreamClient(upstreamVictoriaLogs),
+		reportCache: cache.New[*models.ReadinessReport]("readiness", cfg.Health.CacheTTL, 1),
+	}
+	s.config.Store(cfg)
+	return s
+}
+
+// UpdateConfig swaps in a reloaded configuration
+func (s *HealthService) UpdateConfig(cfg *config.Config) {
+	s.config.Store(cfg)
+	s.reportCache.SetTTL(cfg.Health.CacheTTL)
+}
+
+type dependencyCheck struct {
+	name     string
+	critical bool
+	probe    func(ctx context.Context) error
+}
+
+// Readiness probes every dependency concurrently, reusing a recent result
+// for health.cache_ttl
+func (s *HealthService) Readiness(ctx context.Context) (*models.ReadinessReport, error) {
+	return s.reportCache.Get("", func() (*models.ReadinessReport, error) {
+		// Shared by every probe waiting on the result, so it must not be
+		// cancelled when the first caller goes away
+		return s.checkDependencies(context.WithoutCancel(ctx)), nil
+	})
+}
+
+func (s *HealthService) checkDependencies(ctx context.Context) *models.ReadinessReport {
+	cfg := s.config.Load()
+	ctx, cancel := context.WithTimeout(ctx, cfg.Health.Timeout)
+	defer cancel()
+
+	checks := []dependencyCheck{
+		{"kubernetes", true, s.k8sClient.Ping},
+		{"kubernetes_rbac", true, s.checkRBAC},
+		{"victoria_metrics", false, func(ctx context.Context) error {
+			return probeHealth(ctx, s.vmClient, cfg.Metrics.VictoriaMetricsURL)
+		}},
+		{"victoria_logs", false, func(ctx context.Context) error {
+			return probeHealth(ctx, s.logsClient, cfg.Logs.VictoriaLogsURL)
+		}},
+	}
+
+	report := &models.ReadinessReport{
+		Status:       models.ReadinessOK,
+		CheckedAt:    time.Now(),
+		Dependencies: make([]models.DependencyStatus, len(checks)),
+	}
+	runBounded(len(checks), func(i int) {
+		start := time.Now()
+		err := checks[i].probe(ctx)
+		status := models.DependencyStatus{
+			Name:      checks[i].name,
+			Up:        err == nil,
+			Critical:  checks[i].critical,
+			LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			status.Error = err.Error()
+		}
+		report.Dependencies[i] = status
+	})
+
+	for _, dep := range report.Dependencies {
+		if dep.Up {
+			continue
+		}
+		s.logger.Warnf("Readiness check %s failed: %s", dep.Name, dep.Error)
+		if dep.Critical {
+			report.Status = models.ReadinessUnavailable
+		} else if report.Status == models.ReadinessOK {
+			report.Status = models.ReadinessDegraded
+		}
+	}
+	return report
+}
+
+// checkRBAC verifies the service account may read and update the policy
+// ConfigMap and the ingress controller ConfigMap
+func (s *HealthService) checkRBAC(ctx context.Context) error {
+	k := s.config.Load().Kubernetes
+	var denied []string
+	for _, cm := range []struct{ namespace, name string }{
+		{k.Namespace, k.WAFPoliciesConfigMapName},
+		{k.IngressControllerNamespace, k.IngressControllerConfigMapName},
+	} {
+		for _, verb := range []string{"get", "update"} {
+			allowed, _, err := s.k8sClient.CanI(ctx, authorizationv1.ResourceAttributes{
+				Namespace: cm.namespace,
+				Verb:      verb,
+				Resource:  "configmaps",
+				Name:      cm.name,
+			})
+			if err != nil {
+				return err
+			}
+			if !allowed {
+				denied = append(denied, fmt.Sprintf("%s configmaps/%s in %s", verb, cm.name, cm.namespace))
+			}
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("permission denied: %s", strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+// probeHealth calls the /health endpoint that VictoriaMetrics and
+// VictoriaLogs serve
+func probeHealth(ctx context.Context, client *http.Client, baseURL string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(baseURL, "/")+"/health", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
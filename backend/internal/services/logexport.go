@@ -0,0 +1,383 @@
+package services
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"waf-admin/internal/auth"
+	"waf-admin/internal/config"
+	"waf-admin/internal/models"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrTooManyExports is returned when logs.export.max_concurrent exports are
+// already running
+var ErrTooManyExports = errors.New("too many concurrent log exports")
+
+var logExportRows = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "waf_admin_log_export_rows_total",
+	Help: "Log entries written by log exports, by format.",
+}, []string{"format"})
+
+// defaultExportColumns are exported when a request names no columns
+var defaultExportColumns = []string{"timestamp", "host", "status", "method", "path", "client_ip", "rule_id", "message"}
+
+const (
+	maxExportColumns = 100
+	// parquetRowGroupSize bounds the rows a parquet export buffers before
+	// writing them out as a row group
+	parquetRowGroupSize = 50000
+)
+
+var exportColumnPattern = regexp.MustCompile(`^[A-Za-z0-9_.:@-]+$`)
+
+// LogExport is a validated export ready to be written
+type LogExport struct {
+	request models.LogExportRequest
+	service *LogsService
+}
+
+// logExportAudit is the audit record of an export
+type logExportAudit struct {
+	Request  models.LogExportRequest `json:"request"`
+	Rows     int64                   `json:"rows"`
+	Duration string                  `json:"duration"`
+	Error    string                  `json:"error,omitempty"`
+}
+
+// ExportConfig returns the current log export settings
+func (s *LogsService) ExportConfig() config.LogExportConfig {
+	return s.config.Load().Logs.Export
+}
+
+// PrepareExport validates an export request, fills in its defaults and
+// reserves one of logs.export.max_concurrent slots, so that the caller can
+// reject it before starting a response. The slot is released when Write
+// returns, which must be called on the returned export.
+func (s *LogsService) PrepareExport(req models.LogExportRequest) (*LogExport, error) {
+	req.Format = strings.ToLower(strings.TrimSpace(req.Format))
+	switch req.Format {
+	case "":
+		req.Format = models.ExportFormatCSV
+	case models.ExportFormatCSV, models.ExportFormatNDJSON, models.ExportFormatParquet:
+	default:
+		return nil, fmt.Errorf("%w: format must be %s, %s or %s, got %q", ErrInvalidLogQuery,
+			models.ExportFormatCSV, models.ExportFormatNDJSON, models.ExportFormatParquet, req.Format)
+	}
+
+	if len(req.Columns) == 0 {
+		req.Columns = defaultExportColumns
+	}
+	if len(req.Columns) > maxExportColumns {
+		return nil, fmt.Errorf("%w: at most %d columns can be exported", ErrInvalidLogQuery, maxExportColumns)
+	}
+	seen := make(map[string]bool, len(req.Columns))
+	for _, column := range req.Columns {
+		if !exportColumnPattern.MatchString(column) {
+			return nil, fmt.Errorf("%w: invalid column %q", ErrInvalidLogQuery, column)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("%w: column %q is listed twice", ErrInvalidLogQuery, column)
+		}
+		seen[column] = true
+	}
+
+	timeRange := req.TimeRange
+	if timeRange.Start.IsZero() || timeRange.End.IsZero() {
+		return nil, fmt.Errorf("%w: an export needs a time range", ErrInvalidLogQuery)
+	}
+	if !timeRange.End.After(timeRange.Start) {
+		return nil, fmt.Errorf("%w: time range end must be after start", ErrInvalidLogQuery)
+	}
+	req.Limit, req.Offset = 0, 0
+
+	// Compile once to reject invalid filters up front
+	if _, err := compileLogQuery(req.LogQuery, true); err != nil {
+		return nil, err
+	}
+
+	if n := s.activeExports.Add(1); n > int64(s.config.Load().Logs.Export.MaxConcurrent) {
+		s.activeExports.Add(-1)
+		return nil, ErrTooManyExports
+	}
+	return &LogExport{request: req, service: s}, nil
+}
+
+// ContentType returns the media type of the export file
+func (e *LogExport) ContentType() string {
+	if e.request.Gzip {
+		return "application/gzip"
+	}
+	switch e.request.Format {
+	case models.ExportFormatNDJSON:
+		return "application/x-ndjson"
+	case models.ExportFormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// FileName returns a file name naming the exported time range
+func (e *LogExport) FileName() string {
+	const layout = "20060102T150405Z"
+	name := fmt.Sprintf("waf-logs-%s-%s.%s", e.request.TimeRange.Start.UTC().Format(layout),
+		e.request.TimeRange.End.UTC().Format(layout), e.request.Format)
+	if e.request.Gzip {
+		name += ".gz"
+	}
+	return name
+}
+
+// Write writes every matching entry to w, oldest first, and returns the
+// number written. The time range is queried in logs.export.chunk_duration
+// slices over a connection without a timeout, so an export has no size
+// limit and only one entry is held at a time, or one row group for
+// parquet. The export is audited with its outcome once it ends.
+// Write may only be called once.
+func (e *LogExport) Write(ctx context.Context, w io.Writer) (rows int64, err error) {
+	s := e.service
+	cfg := s.config.Load().Logs
+	defer s.activeExports.Add(-1)
+
+	started := time.Now()
+	defer func() {
+		record := logExportAudit{Request: e.request, Rows: rows, Duration: time.Since(started).Round(time.Millisecond).String()}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		s.audit(ctx, "EXPORT_LOGS", e.request.Format, record)
+		logExportRows.WithLabelValues(e.request.Format).Add(float64(rows))
+	}()
+
+	var gz *gzip.Writer
+	if e.request.Gzip {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	out, err := newExportWriter(e.request.Format, e.request.Columns, w)
+	if err != nil {
+		return 0, err
+	}
+
+	query := e.request.LogQuery
+	end := e.request.TimeRange.End
+	for start := e.request.TimeRange.Start; start.Before(end); start = start.Add(cfg.Export.ChunkDuration) {
+		chunk := models.TimeRange{Start: start, End: start.Add(cfg.Export.ChunkDuration)}
+		if chunk.End.After(end) {
+			chunk.End = end
+		}
+		query.TimeRange = chunk
+		filter, err := compileLogQuery(query, true)
+		if err != nil {
+			return rows, err
+		}
+		err = streamLogEntries(ctx, s.tailClient, cfg.VictoriaLogsURL, filter+" | sort by (_time)", chunk, func(entry models.LogEntry) error {
+			rows++
+			return out.write(entry)
+		})
+		if err != nil {
+			return rows, err
+		}
+		if err := out.flush(); err != nil {
+			return rows, err
+		}
+	}
+
+	if err := out.close(); err != nil {
+		return rows, err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return rows, err
+		}
+	}
+	return rows, nil
+}
+
+// audit records an access to the logs, such as an export
+func (s *LogsService) audit(ctx context.Context, action, id string, details interface{}) {
+	if s.auditService == nil {
+		return
+	}
+	user := "system"
+	if u, ok := auth.UserFromContext(ctx); ok && u.Name != "" {
+		user = u.Name
+	}
+	auditLog := s.auditService.CreateAuditLog(action, "logs", id, user, "", "", nil, details)
+	if err := s.auditService.LogChange(context.WithoutCancel(ctx), auditLog); err != nil {
+		s.logger.Warnf("Failed to log audit change: %v", err)
+	}
+}
+
+// exportValue returns the value of column for entry and whether the entry
+// has it
+func exportValue(entry models.LogEntry, column string) (string, bool) {
+	switch column {
+	case "timestamp":
+		return entry.Timestamp.UTC().Format(time.RFC3339Nano), !entry.Timestamp.IsZero()
+	case "message":
+		return entry.Message, true
+	case "client_ip":
+		column = "remote_addr"
+	}
+	switch v := entry.Fields[column].(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// exportWriter encodes entries in one export format. flush is called after
+// each time range chunk and close once at the end.
+type exportWriter interface {
+	write(entry models.LogEntry) error
+	flush() error
+	close() error
+}
+
+func newExportWriter(format string, columns []string, w io.Writer) (exportWriter, error) {
+	switch format {
+	case models.ExportFormatNDJSON:
+		return &ndjsonExportWriter{columns: columns, encoder: json.NewEncoder(w)}, nil
+	case models.ExportFormatParquet:
+		return newParquetExportWriter(columns, w), nil
+	default:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(columns); err != nil {
+			return nil, err
+		}
+		return &csvExportWriter{columns: columns, writer: cw, record: make([]string, len(columns))}, nil
+	}
+}
+
+type csvExportWriter struct {
+	columns []string
+	writer  *csv.Writer
+	record  []string
+}
+
+func (c *csvExportWriter) write(entry models.LogEntry) error {
+	for i, column := range c.columns {
+		c.record[i], _ = exportValue(entry, column)
+	}
+	return c.writer.Write(c.record)
+}
+
+func (c *csvExportWriter) flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *csvExportWriter) close() error {
+	return c.flush()
+}
+
+// ndjsonExportWriter writes one object per entry, omitting columns the
+// entry does not have
+type ndjsonExportWriter struct {
+	columns []string
+	encoder *json.Encoder
+}
+
+func (n *ndjsonExportWriter) write(entry models.LogEntry) error {
+	record := make(map[string]string, len(n.columns))
+	for _, column := range n.columns {
+		if value, ok := exportValue(entry, column); ok {
+			record[column] = value
+		}
+	}
+	return n.encoder.Encode(record)
+}
+
+func (n *ndjsonExportWriter) flush() error { return nil }
+
+func (n *ndjsonExportWriter) close() error { return nil }
+
+// parquetExportWriter writes the timestamp as a timestamp column and every
+// other column as an optional string, since log fields have no fixed type
+type parquetExportWriter struct {
+	writer  *parquet.Writer
+	columns []string
+	// index maps each requested column to its position in the schema,
+	// which orders columns by name
+	index    []int
+	row      parquet.Row
+	buffered int
+}
+
+func newParquetExportWriter(columns []string, w io.Writer) *parquetExportWriter {
+	group := make(parquet.Group, len(columns))
+	for _, column := range columns {
+		if column == "timestamp" {
+			group[column] = parquet.Optional(parquet.Timestamp(parquet.Microsecond))
+		} else {
+			group[column] = parquet.Optional(parquet.String())
+		}
+	}
+	schema := parquet.NewSchema("waf_logs", group)
+
+	positions := make(map[string]int, len(columns))
+	for i, path := range schema.Columns() {
+		positions[path[0]] = i
+	}
+	index := make([]int, len(columns))
+	for i, column := range columns {
+		index[i] = positions[column]
+	}
+
+	return &parquetExportWriter{
+		writer:  parquet.NewWriter(w, schema),
+		columns: columns,
+		index:   index,
+		row:     make(parquet.Row, len(columns)),
+	}
+}
+
+func (p *parquetExportWriter) write(entry models.LogEntry) error {
+	for i, column := range p.columns {
+		col := p.index[i]
+		value, ok := exportValue(entry, column)
+		switch {
+		case !ok:
+			p.row[col] = parquet.NullValue().Level(0, 0, col)
+		case column == "timestamp":
+			p.row[col] = parquet.Int64Value(entry.Timestamp.UnixMicro()).Level(0, 1, col)
+		default:
+			p.row[col] = parquet.ByteArrayValue([]byte(value)).Level(0, 1, col)
+		}
+	}
+	if _, err := p.writer.WriteRows([]parquet.Row{p.row}); err != nil {
+		return err
+	}
+	if p.buffered++; p.buffered >= parquetRowGroupSize {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *parquetExportWriter) flush() error {
+	if p.buffered == 0 {
+		return nil
+	}
+	p.buffered = 0
+	return p.writer.Flush()
+}
+
+func (p *parquetExportWriter) close() error {
+	return p.writer.Close()
+}
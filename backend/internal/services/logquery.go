@@ -0,0 +1,141 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"waf-admin/internal/models"
+)
+
+// ErrInvalidLogQuery is returned for log queries whose filters cannot be
+// compiled
+var ErrInvalidLogQuery = errors.New("invalid log query")
+
+var (
+	methodPattern = regexp.MustCompile(`^[A-Z]+$`)
+	ruleIDPattern = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// compileLogQuery turns the typed filters of query into a LogsQL filter.
+// Every user-supplied value is quoted or checked against a strict pattern,
+// so only the explicitly advanced raw query can contain LogsQL syntax.
+// The time range is added when withTime is set; live tails have none.
+func compileLogQuery(query models.LogQuery, withTime bool) (string, error) {
+	var conditions []string
+
+	if withTime && !query.TimeRange.Start.IsZero() && !query.TimeRange.End.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("_time:[%s, %s)",
+			query.TimeRange.Start.Format(time.RFC3339Nano), query.TimeRange.End.Format(time.RFC3339Nano)))
+	}
+
+	if len(query.Hosts) > 0 {
+		conditions = append(conditions, inFilter("host", query.Hosts))
+	}
+
+	if len(query.Status) > 0 {
+		var alternatives []string
+		for _, r := range query.Status {
+			max := r.Max
+			if max == 0 {
+				max = r.Min
+			}
+			if r.Min < 100 || max > 599 || r.Min > max {
+				return "", fmt.Errorf("%w: status range %d-%d must lie within 100-599 with min not above max", ErrInvalidLogQuery, r.Min, r.Max)
+			}
+			if r.Min == max {
+				alternatives = append(alternatives, "status:="+strconv.Itoa(r.Min))
+			} else {
+				alternatives = append(alternatives, fmt.Sprintf("status:range[%d, %d]", r.Min, max))
+			}
+		}
+		conditions = append(conditions, anyOf(alternatives))
+	}
+
+	if len(query.Methods) > 0 {
+		methods := make([]string, 0, len(query.Methods))
+		for _, m := range query.Methods {
+			m = strings.ToUpper(strings.TrimSpace(m))
+			if !methodPattern.MatchString(m) {
+				return "", fmt.Errorf("%w: invalid method %q", ErrInvalidLogQuery, m)
+			}
+			methods = append(methods, m)
+		}
+		conditions = append(conditions, inFilter("method", methods))
+	}
+
+	if len(query.ClientIPs) > 0 {
+		var alternatives []string
+		for _, raw := range query.ClientIPs {
+			raw = strings.TrimSpace(raw)
+			if ip := net.ParseIP(raw); ip != nil {
+				alternatives = append(alternatives, "remote_addr:="+strconv.Quote(ip.String()))
+				continue
+			}
+			ip, network, err := net.ParseCIDR(raw)
+			if err != nil {
+				return "", fmt.Errorf("%w: %q is not an IP address or CIDR range", ErrInvalidLogQuery, raw)
+			}
+			// LogsQL only has range filters for IPv4
+			if ip.To4() == nil {
+				return "", fmt.Errorf("%w: CIDR range %q is not IPv4", ErrInvalidLogQuery, raw)
+			}
+			alternatives = append(alternatives, "remote_addr:ipv4_range("+strconv.Quote(network.String())+")")
+		}
+		conditions = append(conditions, anyOf(alternatives))
+	}
+
+	if len(query.RuleIDs) > 0 {
+		for _, id := range query.RuleIDs {
+			if !ruleIDPattern.MatchString(id) {
+				return "", fmt.Errorf("%w: rule ID %q must be numeric", ErrInvalidLogQuery, id)
+			}
+		}
+		conditions = append(conditions, inFilter("rule_id", query.RuleIDs))
+	}
+
+	if query.PathPrefix != "" {
+		conditions = append(conditions, "path:="+strconv.Quote(query.PathPrefix)+"*")
+	}
+
+	// Free text is a case-insensitive substring of the message
+	if text := strings.TrimSpace(query.Text); text != "" {
+		conditions = append(conditions, "_msg:~"+strconv.Quote("(?i)"+regexp.QuoteMeta(text)))
+	}
+
+	// "*" was sent by older clients for "no filter"
+	if raw := strings.TrimSpace(query.Query); raw != "" && raw != "*" {
+		if !query.Advanced {
+			return "", fmt.Errorf("%w: query is raw LogsQL and requires advanced to be set; use the typed filters otherwise", ErrInvalidLogQuery)
+		}
+		conditions = append(conditions, "("+raw+")")
+	}
+
+	if len(conditions) == 0 {
+		return "*", nil
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// inFilter matches a field against any of values exactly
+func inFilter(field string, values []string) string {
+	if len(values) == 1 {
+		return field + ":=" + strconv.Quote(values[0])
+	}
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return field + ":in(" + strings.Join(quoted, ", ") + ")"
+}
+
+func anyOf(alternatives []string) string {
+	if len(alternatives) == 1 {
+		return alternatives[0]
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
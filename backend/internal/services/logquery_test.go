@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"waf-admin/internal/models"
+)
+
+func TestCompileLogQuery(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		query    models.LogQuery
+		withTime bool
+		want     string
+		wantErr  bool
+	}{
+		{name: "no filters", want: "*"},
+		{name: "legacy star", query: models.LogQuery{Query: " * "}, want: "*"},
+		{
+			name:     "time range",
+			query:    models.LogQuery{TimeRange: models.TimeRange{Start: start, End: end}},
+			withTime: true,
+			want:     "_time:[2024-05-01T10:00:00Z, 2024-05-01T11:00:00Z)",
+		},
+		{
+			name:  "time range without withTime",
+			query: models.LogQuery{TimeRange: models.TimeRange{Start: start, End: end}},
+			want:  "*",
+		},
+		{
+			name:  "host",
+			query: models.LogQuery{Hosts: []string{"example.com"}},
+			want:  `host:="example.com"`,
+		},
+		{
+			name:  "hosts with LogsQL syntax are quoted",
+			query: models.LogQuery{Hosts: []string{`a"b`, `c\d`, "e|f", "g) OR (*"}},
+			want:  `host:in("a\"b", "c\\d", "e|f", "g) OR (*")`,
+		},
+		{
+			name:  "path prefix with LogsQL syntax is quoted",
+			query: models.LogQuery{PathPrefix: `/api") OR ("x\|`},
+			want:  `path:="/api\") OR (\"x\\|"*`,
+		},
+		{
+			name:  "free text is quoted and escaped for the regexp",
+			query: models.LogQuery{Text: ` a"b\c|d) `},
+			want:  `_msg:~"(?i)a\"b\\\\c\\|d\\)"`,
+		},
+		{
+			name:  "status codes and ranges",
+			query: models.LogQuery{Status: []models.StatusRange{{Min: 403}, {Min: 500, Max: 599}, {Min: 404, Max: 404}}},
+			want:  "(status:=403 OR status:range[500, 599] OR status:=404)",
+		},
+		{name: "status below 100", query: models.LogQuery{Status: []models.StatusRange{{Min: 99}}}, wantErr: true},
+		{name: "status above 599", query: models.LogQuery{Status: []models.StatusRange{{Min: 500, Max: 600}}}, wantErr: true},
+		{name: "status min above max", query: models.LogQuery{Status: []models.StatusRange{{Min: 500, Max: 400}}}, wantErr: true},
+		{
+			name:  "methods are upper-cased",
+			query: models.LogQuery{Methods: []string{"get", " POST "}},
+			want:  `method:in("GET", "POST")`,
+		},
+		{name: "invalid method", query: models.LogQuery{Methods: []string{`GET" OR "`}}, wantErr: true},
+		{
+			name:  "client IPs and IPv4 CIDR",
+			query: models.LogQuery{ClientIPs: []string{"10.0.0.1", "2001:db8::1", "192.168.1.7/24"}},
+			want:  `(remote_addr:="10.0.0.1" OR remote_addr:="2001:db8::1" OR remote_addr:ipv4_range("192.168.1.0/24"))`,
+		},
+		{name: "IPv6 CIDR", query: models.LogQuery{ClientIPs: []string{"2001:db8::/32"}}, wantErr: true},
+		{name: "invalid client IP", query: models.LogQuery{ClientIPs: []string{"10.0.0.1 OR *"}}, wantErr: true},
+		{
+			name:  "rule IDs",
+			query: models.LogQuery{RuleIDs: []string{"942100"}},
+			want:  `rule_id:="942100"`,
+		},
+		{name: "non-numeric rule ID", query: models.LogQuery{RuleIDs: []string{"942100*"}}, wantErr: true},
+		{name: "raw query without advanced", query: models.LogQuery{Query: "status:403"}, wantErr: true},
+		{
+			name:  "raw query with advanced",
+			query: models.LogQuery{Query: "status:403 OR status:429", Advanced: true, Hosts: []string{"example.com"}},
+			want:  `host:="example.com" AND (status:403 OR status:429)`,
+		},
+		{
+			name: "filters are combined",
+			query: models.LogQuery{
+				Hosts:      []string{"example.com"},
+				Status:     []models.StatusRange{{Min: 403}},
+				PathPrefix: "/admin",
+			},
+			want: `host:="example.com" AND status:=403 AND path:="/admin"*`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compileLogQuery(tt.query, tt.withTime)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidLogQuery) {
+					t.Fatalf("compileLogQuery() = %q, %v; want ErrInvalidLogQuery", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compileLogQuery(): %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("compileLogQuery() =\n  %s\nwant\n  %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,14 +1,20 @@
 package services
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"waf-admin/internal/cache"
 	"waf-admin/internal/config"
 	"waf-admin/internal/models"
 
@@ -16,128 +22,267 @@ import (
 )
 
 type LogsService struct {
-	config *config.Config
-	logger *logrus.Logger
+	config       atomic.Pointer[config.Config]
+	logger       *logrus.Logger
+	client       *http.Client
+	filtersCache *cache.Cache[*models.LogFilters]
+
+	// tailClient has no overall timeout, since tails and exports stream
+	// for as long as they take
+	tailClient    *http.Client
+	activeTails   atomic.Int64
+	activeExports atomic.Int64
+	auditService  *AuditService
 }
 
 func NewLogsService(cfg *config.Config, logger *logrus.Logger) *LogsService {
-	return &LogsService{
-		config: cfg,
-		logger: logger,
+	s := &LogsService{
+		logger:       logger,
+		client:       newUpstreamClient(upstreamVictoriaLogs),
+		filtersCache: cache.New[*models.LogFilters]("log_filters", cfg.Cache.TTL, cfg.Cache.MaxEntries),
 	}
+	s.tailClient = newUpstreamClient(upstreamVictoriaLogs)
+	s.tailClient.Timeout = 0
+	s.config.Store(cfg)
+	return s
+}
+
+// SetAuditService records log exports in the audit log
+func (s *LogsService) SetAuditService(auditService *AuditService) {
+	s.auditService = auditService
+}
+
+// UpdateConfig swaps in a reloaded configuration
+func (s *LogsService) UpdateConfig(cfg *config.Config) {
+	s.config.Store(cfg)
+	s.filtersCache.SetTTL(cfg.Cache.TTL)
 }
 
+const (
+	defaultLogSearchLimit = 100
+	maxLogSearchLimit     = 1000
+	// defaultLogSearchWindow bounds searches sent without a time range
+	defaultLogSearchWindow = time.Hour
+)
+
+// SearchLogs returns one page of entries matching query, newest first, and
+// the total number of matches. VictoriaLogs' query endpoint has no offset
+// parameter, so paging is done with sort, offset and limit pipes; the total
+// comes from a separate stats query run alongside it.
 func (s *LogsService) SearchLogs(ctx context.Context, query models.LogQuery) (*models.LogSearchResult, error) {
-	// Build VictoriaLogs query
-	logSQL := s.buildLogSQL(query)
-	
-	u, err := url.Parse(s.config.Logs.VictoriaLogsURL + "/select/logsql/query")
+	if query.Limit == 0 {
+		query.Limit = defaultLogSearchLimit
+	}
+	if query.Limit < 0 || query.Limit > maxLogSearchLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d, got %d", ErrInvalidLogQuery, maxLogSearchLimit, query.Limit)
+	}
+	if query.Offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative, got %d", ErrInvalidLogQuery, query.Offset)
+	}
+	if query.TimeRange.Start.IsZero() || query.TimeRange.End.IsZero() {
+		query.TimeRange.End = time.Now()
+		query.TimeRange.Start = query.TimeRange.End.Add(-defaultLogSearchWindow)
+	}
+
+	filter, err := compileLogQuery(query, true)
 	if err != nil {
 		return nil, err
 	}
 
+	baseURL := s.config.Load().Logs.VictoriaLogsURL
+	var (
+		wg                   sync.WaitGroup
+		entries              []models.LogEntry
+		total                int
+		entriesErr, countErr error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		// One extra entry tells whether another page follows
+		page := fmt.Sprintf("%s | sort by (_time desc) | offset %d | limit %d", filter, query.Offset, query.Limit+1)
+		entries, entriesErr = s.queryLogEntries(ctx, baseURL, page, query.TimeRange)
+	}()
+	go func() {
+		defer wg.Done()
+		total, countErr = s.countLogs(ctx, baseURL, filter, query.TimeRange)
+	}()
+	wg.Wait()
+
+	if entriesErr != nil {
+		return nil, entriesErr
+	}
+	if countErr != nil {
+		return nil, countErr
+	}
+
+	result := &models.LogSearchResult{
+		Entries:   entries,
+		Total:     total,
+		TimeRange: query.TimeRange,
+	}
+	if len(entries) > query.Limit {
+		result.Entries = entries[:query.Limit]
+		result.HasMore = true
+	}
+	return result, nil
+}
+
+// queryLogEntries runs a LogsQL query and returns the entries it matched
+func (s *LogsService) queryLogEntries(ctx context.Context, baseURL, logSQL string, timeRange models.TimeRange) ([]models.LogEntry, error) {
+	entries := []models.LogEntry{}
+	err := streamLogEntries(ctx, s.client, baseURL, logSQL, timeRange, func(entry models.LogEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// streamLogEntries runs a LogsQL query and stream-parses the JSON lines it
+// returns, passing each entry to fn as it is read. An error from fn stops
+// the query.
+func streamLogEntries(ctx context.Context, client *http.Client, baseURL, logSQL string, timeRange models.TimeRange, fn func(models.LogEntry) error) error {
+	u, err := url.Parse(baseURL + "/select/logsql/query")
+	if err != nil {
+		return err
+	}
+
 	q := u.Query()
 	q.Set("query", logSQL)
-	q.Set("limit", fmt.Sprintf("%d", query.Limit))
-	q.Set("offset", fmt.Sprintf("%d", query.Offset))
-	q.Set("start", query.TimeRange.Start.Format(time.RFC3339))
-	q.Set("end", query.TimeRange.End.Format(time.RFC3339))
+	q.Set("start", timeRange.Start.Format(time.RFC3339Nano))
+	q.Set("end", timeRange.End.Format(time.RFC3339Nano))
 	u.RawQuery = q.Encode()
 
 	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("victoria logs returned status %d", resp.StatusCode)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("victoria logs returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
 
-	var vlResult VictoriaLogsResult
-	if err := json.NewDecoder(resp.Body).Decode(&vlResult); err != nil {
-		return nil, err
-	}
-
-	result := &models.LogSearchResult{
-		TimeRange: query.TimeRange,
-		Total:     vlResult.Total,
-		Entries:   make([]models.LogEntry, 0, len(vlResult.Logs)),
-	}
-
-	for _, log := range vlResult.Logs {
-		entry := models.LogEntry{
-			Timestamp: log.Timestamp,
-			Message:   log.Message,
-			Fields:    log.Fields,
-		}
-
-		// Extract common fields
-		if host, ok := log.Fields["host"].(string); ok {
-			entry.Host = host
-		}
-		if status, ok := log.Fields["status"].(float64); ok {
-			entry.Status = int(status)
-		}
-		if ruleID, ok := log.Fields["rule_id"].(string); ok {
-			entry.RuleID = ruleID
-		}
-		if clientIP, ok := log.Fields["remote_addr"].(string); ok {
-			entry.ClientIP = clientIP
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
 		}
-		if path, ok := log.Fields["path"].(string); ok {
-			entry.Path = path
+		var fields map[string]interface{}
+		if err := json.Unmarshal(line, &fields); err != nil {
+			return fmt.Errorf("failed to decode log line: %w", err)
 		}
-		if method, ok := log.Fields["method"].(string); ok {
-			entry.Method = method
+		if err := fn(logEntryFromFields(fields)); err != nil {
+			return err
 		}
-
-		result.Entries = append(result.Entries, entry)
 	}
+	return scanner.Err()
+}
 
-	return result, nil
+// countLogs returns the number of entries matching filter
+func (s *LogsService) countLogs(ctx context.Context, baseURL, filter string, timeRange models.TimeRange) (int, error) {
+	rows, err := queryLogStats(ctx, s.client, baseURL, filter+" | stats count() total", timeRange)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	total, err := strconv.Atoi(rows[0]["total"])
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse log count %q: %w", rows[0]["total"], err)
+	}
+	return total, nil
 }
 
-func (s *LogsService) buildLogSQL(query models.LogQuery) string {
-	var conditions []string
+const (
+	defaultFilterValuesLimit = 50
+	maxFilterValuesLimit     = 500
+)
 
-	if query.Query != "" {
-		conditions = append(conditions, query.Query)
-	}
+// logFilterFields are the log fields whose values are offered as filters
+var logFilterFields = []struct{ name, field string }{
+	{"hosts", "host"},
+	{"status codes", "status"},
+	{"methods", "method"},
+	{"rule IDs", "rule_id"},
+}
 
-	// Add time-based conditions
-	if query.TimeRange.Start.Unix() > 0 && query.TimeRange.End.Unix() > 0 {
-		conditions = append(conditions, fmt.Sprintf("_time:%s..%s", 
-			query.TimeRange.Start.Format(time.RFC3339),
-			query.TimeRange.End.Format(time.RFC3339)))
+// GetLogFilters returns the hosts, status codes, methods and rule IDs
+// present in the logs over timeRange, most frequent first with up to limit
+// values each. The range is aligned like the metrics summary so that
+// requests for a sliding window share the cache.
+func (s *LogsService) GetLogFilters(ctx context.Context, timeRange models.TimeRange, limit int) (*models.LogFilters, error) {
+	window := timeRange.End.Sub(timeRange.Start)
+	if window <= 0 {
+		return nil, fmt.Errorf("%w: time range end must be after start", ErrInvalidLogQuery)
+	}
+	if limit <= 0 {
+		limit = defaultFilterValuesLimit
+	}
+	if limit > maxFilterValuesLimit {
+		limit = maxFilterValuesLimit
 	}
 
-	if len(conditions) == 0 {
-		return "*"
+	step := selectStep(window)
+	aligned := models.TimeRange{
+		Start: timeRange.Start.Truncate(step),
+		End:   timeRange.End.Truncate(step),
+	}
+	if !aligned.End.After(aligned.Start) {
+		aligned = timeRange
 	}
 
-	return strings.Join(conditions, " AND ")
+	key := fmt.Sprintf("%d|%d|%d", aligned.Start.Unix(), aligned.End.Unix(), limit)
+	return s.filtersCache.Get(key, func() (*models.LogFilters, error) {
+		return s.loadLogFilters(context.WithoutCancel(ctx), aligned, limit)
+	})
 }
 
-func (s *LogsService) GetLogFilters() map[string][]string {
-	return map[string][]string{
-		"status": {"200", "403", "404", "500", "502", "503"},
-		"method": {"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS"},
-		"rule_id": {"942100", "942110", "942120", "913100", "913110"}, // Common CRS rule IDs
+// loadLogFilters counts the values of each filter field with a stats query
+// per field. A field whose query fails is reported in the warnings; an
+// error is returned only when every query failed.
+func (s *LogsService) loadLogFilters(ctx context.Context, timeRange models.TimeRange, limit int) (*models.LogFilters, error) {
+	baseURL := s.config.Load().Logs.VictoriaLogsURL
+	values := make([][]models.LogFieldValue, len(logFilterFields))
+	errs := make([]error, len(logFilterFields))
+	runBounded(len(logFilterFields), func(i int) {
+		field := logFilterFields[i].field
+		// field:* skips entries without the field
+		query := fmt.Sprintf("%s:* | stats by (%s) count() hits | sort by (hits desc) | limit %d", field, field, limit)
+		rows, err := queryLogStats(ctx, s.client, baseURL, query, timeRange)
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		values[i] = make([]models.LogFieldValue, 0, len(rows))
+		for _, row := range rows {
+			hits, _ := strconv.ParseInt(row["hits"], 10, 64)
+			values[i] = append(values[i], models.LogFieldValue{Value: row[field], Hits: hits})
+		}
+	})
+
+	filters := &models.LogFilters{TimeRange: timeRange}
+	for i, err := range errs {
+		if err != nil {
+			filters.Warnings = append(filters.Warnings, fmt.Sprintf("%s: %v", logFilterFields[i].name, err))
+			values[i] = []models.LogFieldValue{}
+		}
 	}
+	if len(filters.Warnings) == len(logFilterFields) {
+		return nil, fmt.Errorf("all log filter queries failed: %s", strings.Join(filters.Warnings, "; "))
+	}
+	filters.Hosts, filters.Status, filters.Methods, filters.RuleIDs = values[0], values[1], values[2], values[3]
+	return filters, nil
 }
-
-type VictoriaLogsResult struct {
-	Total  int `json:"total"`
-	Logs   []struct {
-		Timestamp time.Time              `json:"_time"`
-		Message   string                 `json:"_msg"`
-		Fields    map[string]interface{} `json:"_fields"`
-	} `json:"logs"`
-}
\ No newline at end of file
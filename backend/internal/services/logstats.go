@@ -0,0 +1,114 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"waf-admin/internal/models"
+)
+
+// ModSecurity messages in the ingress-nginx error log carry the matched rule
+// and request as bracketed tags followed by nginx's own request context:
+//
+//	ModSecurity: Access denied with code 403 (phase 2). ... [id "942100"]
+//	[msg "SQL Injection Attack Detected via libinjection"] ... [uri "/login"]
+//	[unique_id "169..."] ..., host: "shop.example.com"
+//
+// The extract pipes below pull those tags into fields for stats queries.
+const (
+	extractRuleID   = `extract '[id "<rule_id>"]'`
+	extractRuleName = `extract '[msg "<rule_name>"]'`
+	extractURI      = `extract '[uri "<path>"]'`
+	extractUniqueID = `extract '[unique_id "<unique_id>"]'`
+	extractHost     = `extract 'host: "<req_host>"'`
+	extractSeverity = `extract '[severity "<severity>"]'`
+	// extractOutcome captures "Access denied with code 403 (phase 2)" for
+	// interventions and "Warning" for matches that did not block
+	extractOutcome = `extract 'ModSecurity: <outcome>. '`
+)
+
+// wafLogsFilter selects ModSecurity messages, optionally for one host. The
+// configured filter is parenthesized so that an OR in it cannot bind to
+// the conditions around it.
+func (s *MetricsService) wafLogsFilter(host string) string {
+	filter := "(" + s.config.Load().Logs.ModSecurityFilter + ")"
+	if host != "" {
+		filter += " | " + extractHost + " | filter req_host:=" + strconv.Quote(host)
+	}
+	return filter
+}
+
+// wafPathsQuery counts distinct flagged transactions per request URI
+func (s *MetricsService) wafPathsQuery(host string, limit int) string {
+	return fmt.Sprintf("%s | %s | %s | stats by (path) count_uniq(unique_id) hits | sort by (hits desc) | limit %d",
+		s.wafLogsFilter(host), extractURI, extractUniqueID, limit)
+}
+
+// wafRulesQuery counts matches per ModSecurity rule ID
+func (s *MetricsService) wafRulesQuery(host string, limit int) string {
+	return fmt.Sprintf("%s | %s | %s | stats by (rule_id) count() hits, min(rule_name) rule_name | sort by (hits desc) | limit %d",
+		s.wafLogsFilter(host), extractRuleID, extractRuleName, limit)
+}
+
+func (s *MetricsService) queryLogStats(ctx context.Context, query string, timeRange models.TimeRange) ([]map[string]string, error) {
+	return queryLogStats(ctx, s.logsClient, s.config.Load().Logs.VictoriaLogsURL, query, timeRange)
+}
+
+// queryLogStats runs a LogsQL stats query against VictoriaLogs. The response
+// is JSON lines with one object per result row; VictoriaLogs encodes every
+// value as a string.
+func queryLogStats(ctx context.Context, client *http.Client, baseURL, query string, timeRange models.TimeRange) ([]map[string]string, error) {
+	u, err := url.Parse(baseURL + "/select/logsql/query")
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	q.Set("query", query)
+	q.Set("start", timeRange.Start.Format(time.RFC3339))
+	q.Set("end", timeRange.End.Format(time.RFC3339))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("victoria logs returned status %d: %s", resp.StatusCode, body)
+	}
+
+	var rows []map[string]string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var row map[string]string
+		if err := json.Unmarshal(line, &row); err != nil {
+			return nil, fmt.Errorf("failed to decode stats row: %w", err)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
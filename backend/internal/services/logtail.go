@@ -0,0 +1,193 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"waf-admin/internal/config"
+	"waf-admin/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrTooManyTails is returned when logs.tail.max_concurrent tails are
+// already open
+var ErrTooManyTails = errors.New("too many concurrent log tails")
+
+var (
+	logTailsActive = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "waf_admin_log_tails_active",
+		Help: "Live log tails currently streaming.",
+	})
+	logTailDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "waf_admin_log_tail_dropped_total",
+		Help: "Log entries dropped because a tail client read slower than logs arrived.",
+	})
+)
+
+// maxLogLineSize bounds one JSON line read from a VictoriaLogs stream
+const maxLogLineSize = 1 << 20
+
+// LogTail is a running live tail. Entries is closed when the stream ends,
+// after which Err reports why.
+type LogTail struct {
+	Entries <-chan models.LogEntry
+
+	dropped atomic.Int64
+	err     error
+}
+
+// Dropped returns the number of entries dropped since the last call
+func (t *LogTail) Dropped() int64 {
+	return t.dropped.Swap(0)
+}
+
+// Err returns the error that ended the stream, or nil if it was cancelled
+// or closed by VictoriaLogs. It is only valid once Entries is closed.
+func (t *LogTail) Err() error {
+	return t.err
+}
+
+// TailConfig returns the current live tail settings
+func (s *LogsService) TailConfig() config.LogTailConfig {
+	return s.config.Load().Logs.Tail
+}
+
+// TailLogs streams new entries matching the filters of query from
+// VictoriaLogs' /select/logsql/tail until ctx is cancelled; its time range,
+// limit and offset are ignored. Entries are buffered up to
+// logs.tail.buffer_size; when the reader falls behind, newer entries are
+// dropped and counted rather than stalling the upstream stream.
+func (s *LogsService) TailLogs(ctx context.Context, query models.LogQuery) (*LogTail, error) {
+	logSQL, err := compileLogQuery(query, false)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := s.config.Load().Logs
+	if n := s.activeTails.Add(1); n > int64(cfg.Tail.MaxConcurrent) {
+		s.activeTails.Add(-1)
+		return nil, ErrTooManyTails
+	}
+	release := func() {
+		s.activeTails.Add(-1)
+		logTailsActive.Dec()
+	}
+	logTailsActive.Inc()
+
+	resp, err := s.openTail(ctx, cfg.VictoriaLogsURL, logSQL)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	entries := make(chan models.LogEntry, cfg.Tail.BufferSize)
+	tail := &LogTail{Entries: entries}
+
+	go func() {
+		defer release()
+		defer close(entries)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(line, &fields); err != nil {
+				s.logger.Warnf("Skipping malformed log tail line: %v", err)
+				continue
+			}
+
+			select {
+			case entries <- logEntryFromFields(fields):
+			default:
+				tail.dropped.Add(1)
+				logTailDropped.Inc()
+			}
+		}
+		if err := scanner.Err(); err != nil && ctx.Err() == nil {
+			tail.err = fmt.Errorf("log tail stream failed: %w", err)
+		}
+	}()
+
+	return tail, nil
+}
+
+func (s *LogsService) openTail(ctx context.Context, baseURL, logSQL string) (*http.Response, error) {
+	u, err := url.Parse(baseURL + "/select/logsql/tail")
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("query", logSQL)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.tailClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("victoria logs returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// logEntryFromFields maps one VictoriaLogs JSON line, which has _time, _msg
+// and every other field at the top level, to a log entry. VictoriaLogs
+// returns all values as strings.
+func logEntryFromFields(fields map[string]interface{}) models.LogEntry {
+	str := func(name string) string {
+		switch v := fields[name].(type) {
+		case string:
+			return v
+		case nil:
+			return ""
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+
+	entry := models.LogEntry{
+		Message:  str("_msg"),
+		Fields:   make(map[string]interface{}, len(fields)),
+		Host:     str("host"),
+		RuleID:   str("rule_id"),
+		ClientIP: str("remote_addr"),
+		Path:     str("path"),
+		Method:   str("method"),
+	}
+	if t, err := time.Parse(time.RFC3339Nano, str("_time")); err == nil {
+		entry.Timestamp = t
+	}
+	if status, err := strconv.Atoi(str("status")); err == nil {
+		entry.Status = status
+	}
+	for name, value := range fields {
+		if name != "_time" && name != "_msg" {
+			entry.Fields[name] = value
+		}
+	}
+	return entry
+}
@@ -3,106 +3,373 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"waf-admin/internal/cache"
 	"waf-admin/internal/config"
 	"waf-admin/internal/models"
 
 	"github.com/sirupsen/logrus"
 )
 
+// maxConcurrentQueries bounds the PromQL queries a single API request runs
+// against VictoriaMetrics at once
+const maxConcurrentQueries = 4
+
 type MetricsService struct {
-	config *config.Config
-	logger *logrus.Logger
+	config       atomic.Pointer[config.Config]
+	logger       *logrus.Logger
+	client       *http.Client
+	logsClient   *http.Client
+	summaryCache *cache.Cache[*models.MetricsSummary]
+	seriesCache  *cache.Cache[*models.TimeSeriesResult]
 }
 
 func NewMetricsService(cfg *config.Config, logger *logrus.Logger) *MetricsService {
-	return &MetricsService{
-		config: cfg,
-		logger: logger,
+	s := &MetricsService{
+		logger:       logger,
+		client:       newUpstreamClient(upstreamVictoriaMetrics),
+		logsClient:   newUpstreamClient(upstreamVictoriaLogs),
+		summaryCache: cache.New[*models.MetricsSummary]("metrics_summary", cfg.Cache.TTL, cfg.Cache.MaxEntries),
+		seriesCache:  cache.New[*models.TimeSeriesResult]("metrics_timeseries", cfg.Cache.TTL, cfg.Cache.MaxEntries),
 	}
+	s.config.Store(cfg)
+	return s
+}
+
+// UpdateConfig swaps in a reloaded configuration
+func (s *MetricsService) UpdateConfig(cfg *config.Config) {
+	s.config.Store(cfg)
+	s.summaryCache.SetTTL(cfg.Cache.TTL)
+	s.seriesCache.SetTTL(cfg.Cache.TTL)
+}
+
+type instantQuery struct {
+	name  string
+	query string
+}
+
+type instantResult struct {
+	result *VMQueryResult
+	err    error
 }
 
-func (s *MetricsService) GetMetricsSummary(ctx context.Context, timeRange models.TimeRange) (*models.MetricsSummary, error) {
+const (
+	defaultTopLimit = 10
+	maxTopLimit     = 100
+)
+
+// ErrInvalidSummaryQuery is returned for a summary time range that cannot
+// be queried
+var ErrInvalidSummaryQuery = errors.New("invalid metrics summary query")
+
+// GetMetricsSummary counts requests over the given time range, optionally
+// for a single host, with up to limit entries in each top list. Only the
+// cache key is aligned to the chart step for the range's length, so that
+// dashboard refreshes a few seconds apart share a result; the summary's
+// TimeRange is the exact range that result was queried for, which may be
+// a request up to one step earlier.
+func (s *MetricsService) GetMetricsSummary(ctx context.Context, timeRange models.TimeRange, host string, limit int) (*models.MetricsSummary, error) {
+	window := timeRange.End.Sub(timeRange.Start)
+	if window <= 0 {
+		return nil, fmt.Errorf("%w: time range end must be after start", ErrInvalidSummaryQuery)
+	}
+	if limit <= 0 {
+		limit = defaultTopLimit
+	}
+	if limit > maxTopLimit {
+		limit = maxTopLimit
+	}
+
+	step := selectStep(window)
+	host = normalizeHost(host)
+
+	// The window length is part of the key so that ranges of different
+	// lengths ending in the same step are not shared
+	key := fmt.Sprintf("%d|%d|%s|%d", timeRange.End.Truncate(step).Unix(), window/step, host, limit)
+	return s.summaryCache.Get(key, func() (*models.MetricsSummary, error) {
+		// The load is shared by every request waiting on this key, so it
+		// must not be cancelled when the first caller goes away
+		return s.loadSummary(context.WithoutCancel(ctx), timeRange, host, limit)
+	})
+}
+
+// loadSummary queries the summary for an exact time range. The independent
+// queries run concurrently; per-host and per-path blocked counts come from
+// "by" queries joined in Go. Each query that fails or returns a partial
+// result is reported in the summary's warnings; an error is returned only
+// when no metrics query succeeded.
+func (s *MetricsService) loadSummary(ctx context.Context, timeRange models.TimeRange, host string, limit int) (*models.MetricsSummary, error) {
 	summary := &models.MetricsSummary{
-		TimeRange: timeRange,
+		TimeRange:  timeRange,
+		TopHosts:   []models.HostMetrics{},
+		TopPaths:   []models.PathMetrics{},
+		TopRuleIDs: []models.RuleMetrics{},
 	}
+	window := timeRange.End.Sub(timeRange.Start)
 
-	// Query total requests
-	totalQuery := fmt.Sprintf(`sum(rate(nginx_ingress_controller_requests[%s]))`, s.formatDuration(timeRange.End.Sub(timeRange.Start)))
-	totalResult, err := s.queryVictoriaMetrics(ctx, totalQuery, timeRange)
-	if err != nil {
-		s.logger.Warnf("Failed to query total requests: %v", err)
-	} else if len(totalResult.Data.Result) > 0 {
-		summary.TotalRequests = int64(totalResult.Data.Result[0].Value[1].(float64))
+	base := `host!=""`
+	if host != "" {
+		base = "host=" + strconv.Quote(host)
+	}
+	// increase() over the whole window gives request counts, where rate()
+	// would give an average per-second value
+	count := func(selector, by string) string {
+		if selector != "" {
+			selector = "," + selector
+		}
+		return fmt.Sprintf(`sum(increase(nginx_ingress_controller_requests{%s%s}[%s]))%s`, base, selector, promDuration(window), by)
+	}
+	wafBlocked := func(by string) string {
+		return fmt.Sprintf(`sum(increase(waf_blocked_total{%s}[%s]))%s`, base, promDuration(window), by)
 	}
 
-	// Query 4xx requests
-	fourXXQuery := fmt.Sprintf(`sum(rate(nginx_ingress_controller_requests{status=~"4.."}[%s]))`, s.formatDuration(timeRange.End.Sub(timeRange.Start)))
-	fourXXResult, err := s.queryVictoriaMetrics(ctx, fourXXQuery, timeRange)
-	if err != nil {
-		s.logger.Warnf("Failed to query 4xx requests: %v", err)
-	} else if len(fourXXResult.Data.Result) > 0 {
-		summary.Status4xx = int64(fourXXResult.Data.Result[0].Value[1].(float64))
+	const (
+		qTotal = iota
+		q4xx
+		q5xx
+		q403
+		qHosts
+		qHostsBlocked
+		qPaths
+		qPathsBlocked
+		qWAFBlocked
+		qWAFBlockedHosts
+	)
+	queries := []instantQuery{
+		qTotal:        {"total requests", count("", "")},
+		q4xx:          {"4xx requests", count(`status=~"4.."`, "")},
+		q5xx:          {"5xx requests", count(`status=~"5.."`, "")},
+		q403:          {"403 requests", count(`status="403"`, "")},
+		qHosts:        {"top hosts", count("", " by (host)")},
+		qHostsBlocked: {"blocked requests by host", count(`status="403"`, " by (host)")},
+		qPaths:        {"top paths", count(`path!=""`, " by (path)")},
+		qPathsBlocked: {"blocked requests by path", count(`path!="",status="403"`, " by (path)")},
+		// ModSecurity interventions exported by WAFEventsExporter; these
+		// series are absent until the exporter has been scraped
+		qWAFBlocked:      {"WAF blocked requests", wafBlocked("")},
+		qWAFBlockedHosts: {"WAF blocked requests by host", wafBlocked(" by (host)")},
 	}
 
-	// Query 5xx requests
-	fiveXXQuery := fmt.Sprintf(`sum(rate(nginx_ingress_controller_requests{status=~"5.."}[%s]))`, s.formatDuration(timeRange.End.Sub(timeRange.Start)))
-	fiveXXResult, err := s.queryVictoriaMetrics(ctx, fiveXXQuery, timeRange)
-	if err != nil {
-		s.logger.Warnf("Failed to query 5xx requests: %v", err)
-	} else if len(fiveXXResult.Data.Result) > 0 {
-		summary.Status5xx = int64(fiveXXResult.Data.Result[0].Value[1].(float64))
+	results := make([]instantResult, len(queries))
+	var wafPaths, wafRules []map[string]string
+	var wafPathsErr, wafRulesErr error
+
+	tasks := make([]func(), 0, len(queries)+2)
+	for i := range queries {
+		i := i
+		tasks = append(tasks, func() {
+			results[i].result, results[i].err = s.queryVictoriaMetrics(ctx, queries[i].query, timeRange)
+		})
 	}
+	tasks = append(tasks,
+		func() { wafPaths, wafPathsErr = s.queryLogStats(ctx, s.wafPathsQuery(host, limit), timeRange) },
+		func() { wafRules, wafRulesErr = s.queryLogStats(ctx, s.wafRulesQuery(host, limit), timeRange) },
+	)
+	runBounded(len(tasks), func(i int) { tasks[i]() })
 
-	// Query 403 requests (WAF blocked)
-	fourZeroThreeQuery := fmt.Sprintf(`sum(rate(nginx_ingress_controller_requests{status="403"}[%s]))`, s.formatDuration(timeRange.End.Sub(timeRange.Start)))
-	fourZeroThreeResult, err := s.queryVictoriaMetrics(ctx, fourZeroThreeQuery, timeRange)
-	if err != nil {
-		s.logger.Warnf("Failed to query 403 requests: %v", err)
-	} else if len(fourZeroThreeResult.Data.Result) > 0 {
-		summary.Status403 = int64(fourZeroThreeResult.Data.Result[0].Value[1].(float64))
-		summary.WAFBlocked = summary.Status403
+	succeeded := 0
+	for i, r := range results {
+		if r.err != nil {
+			summary.Warnings = append(summary.Warnings, fmt.Sprintf("%s: %v", queries[i].name, r.err))
+			continue
+		}
+		succeeded++
+		summary.Warnings = append(summary.Warnings, r.result.warnings(queries[i].name)...)
+	}
+	if succeeded == 0 {
+		return nil, fmt.Errorf("all metrics queries failed: %s", strings.Join(summary.Warnings, "; "))
+	}
+	if wafPathsErr != nil {
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("WAF paths from logs: %v", wafPathsErr))
+	}
+	if wafRulesErr != nil {
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("WAF rule IDs from logs: %v", wafRulesErr))
 	}
 
-	// Query top hosts
-	topHostsQuery := fmt.Sprintf(`sum(rate(nginx_ingress_controller_requests[%s])) by (host)`, s.formatDuration(timeRange.End.Sub(timeRange.Start)))
-	topHostsResult, err := s.queryVictoriaMetrics(ctx, topHostsQuery, timeRange)
-	if err != nil {
-		s.logger.Warnf("Failed to query top hosts: %v", err)
+	summary.TotalRequests = results[qTotal].scalar()
+	summary.Status4xx = results[q4xx].scalar()
+	summary.Status5xx = results[q5xx].scalar()
+	summary.Status403 = results[q403].scalar()
+
+	// Prefer the ModSecurity counters: a 403 can come from auth or the
+	// upstream, and blocks with a custom deny status are not 403s at all
+	blocked := results[qHostsBlocked].byLabel("host")
+	if results[qWAFBlocked].hasData() {
+		summary.WAFBlocked = results[qWAFBlocked].scalar()
+		summary.WAFBlockedSource = models.BlockedSourceModSecurity
+		blocked = results[qWAFBlockedHosts].byLabel("host")
 	} else {
-		for _, result := range topHostsResult.Data.Result {
-			if host, ok := result.Metric["host"]; ok {
-				requests := int64(result.Value[1].(float64))
-				hostMetric := models.HostMetrics{
-					Host:     host,
-					Requests: requests,
-				}
-
-				// Query blocked requests for this host
-				blockedQuery := fmt.Sprintf(`sum(rate(nginx_ingress_controller_requests{host="%s",status="403"}[%s]))`, host, s.formatDuration(timeRange.End.Sub(timeRange.Start)))
-				blockedResult, err := s.queryVictoriaMetrics(ctx, blockedQuery, timeRange)
-				if err == nil && len(blockedResult.Data.Result) > 0 {
-					hostMetric.Blocked = int64(blockedResult.Data.Result[0].Value[1].(float64))
-				}
-
-				if requests > 0 {
-					hostMetric.ErrorRate = float64(hostMetric.Blocked) / float64(requests) * 100
-				}
-
-				summary.TopHosts = append(summary.TopHosts, hostMetric)
-			}
+		summary.WAFBlocked = summary.Status403
+		summary.WAFBlockedSource = models.BlockedSourceStatus403
+	}
+
+	for name, requests := range results[qHosts].byLabel("host") {
+		hostMetric := models.HostMetrics{
+			Host:     name,
+			Requests: requests,
+			Blocked:  blocked[name],
+		}
+		if requests > 0 {
+			hostMetric.ErrorRate = float64(hostMetric.Blocked) / float64(requests) * 100
+		}
+		summary.TopHosts = append(summary.TopHosts, hostMetric)
+	}
+	sort.Slice(summary.TopHosts, func(i, j int) bool {
+		if summary.TopHosts[i].Requests != summary.TopHosts[j].Requests {
+			return summary.TopHosts[i].Requests > summary.TopHosts[j].Requests
 		}
+		return summary.TopHosts[i].Host < summary.TopHosts[j].Host
+	})
+	if len(summary.TopHosts) > limit {
+		summary.TopHosts = summary.TopHosts[:limit]
+	}
+
+	summary.TopPaths = mergeTopPaths(results[qPaths].byLabel("path"), results[qPathsBlocked].byLabel("path"), wafPaths, limit)
+	summary.TopRuleIDs = topRules(wafRules)
+
+	for _, warning := range summary.Warnings {
+		s.logger.Warnf("Metrics summary: %s", warning)
 	}
 
 	return summary, nil
 }
 
+// mergeTopPaths combines ingress path metrics with the request URIs that
+// ModSecurity flagged. Metrics supply request and 403 counts per ingress
+// path; the logs raise a path's blocked count to the number of distinct
+// flagged transactions when that is higher, and add URIs that have no
+// matching ingress path.
+func mergeTopPaths(requests, blocked map[string]int64, wafRows []map[string]string, limit int) []models.PathMetrics {
+	paths := make(map[string]*models.PathMetrics)
+	get := func(path string) *models.PathMetrics {
+		if p, ok := paths[path]; ok {
+			return p
+		}
+		p := &models.PathMetrics{Path: path}
+		paths[path] = p
+		return p
+	}
+
+	for path, n := range requests {
+		get(path).Requests = n
+	}
+	for path, n := range blocked {
+		get(path).Blocked = n
+	}
+	for _, row := range wafRows {
+		if row["path"] == "" {
+			continue
+		}
+		hits, _ := strconv.ParseInt(row["hits"], 10, 64)
+		if p := get(row["path"]); hits > p.Blocked {
+			p.Blocked = hits
+		}
+	}
+
+	out := make([]models.PathMetrics, 0, len(paths))
+	for _, p := range paths {
+		if p.Requests > 0 {
+			p.ErrorRate = float64(p.Blocked) / float64(p.Requests) * 100
+		}
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Blocked != out[j].Blocked {
+			return out[i].Blocked > out[j].Blocked
+		}
+		if out[i].Requests != out[j].Requests {
+			return out[i].Requests > out[j].Requests
+		}
+		return out[i].Path < out[j].Path
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// topRules converts rule-ID stats rows, already sorted and limited by
+// VictoriaLogs, into RuleMetrics
+func topRules(rows []map[string]string) []models.RuleMetrics {
+	rules := make([]models.RuleMetrics, 0, len(rows))
+	for _, row := range rows {
+		if row["rule_id"] == "" {
+			continue
+		}
+		hits, _ := strconv.ParseInt(row["hits"], 10, 64)
+		rules = append(rules, models.RuleMetrics{
+			RuleID:   row["rule_id"],
+			RuleName: row["rule_name"],
+			Count:    hits,
+		})
+	}
+	return rules
+}
+
+// normalizeHost lower-cases a host filter so equivalent requests share a
+// cache entry
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSpace(host))
+}
+
+// hasData reports whether the query succeeded and returned any series
+func (r instantResult) hasData() bool {
+	return r.err == nil && len(r.result.Data.Result) > 0
+}
+
+// scalar returns the count of a single-series result, or 0 when the query
+// failed or matched nothing
+func (r instantResult) scalar() int64 {
+	if r.err != nil || len(r.result.Data.Result) == 0 {
+		return 0
+	}
+	return roundCount(r.result.Data.Result[0].Value)
+}
+
+// byLabel returns the counts of a "by (label)" result keyed by label value
+func (r instantResult) byLabel(label string) map[string]int64 {
+	counts := make(map[string]int64)
+	if r.err != nil {
+		return counts
+	}
+	for _, series := range r.result.Data.Result {
+		if value := series.Metric[label]; value != "" {
+			counts[value] = roundCount(series.Value)
+		}
+	}
+	return counts
+}
+
+// runBounded calls fn for every index in [0, n), running at most
+// maxConcurrentQueries calls at once, and waits for all of them
+func runBounded(n int, fn func(i int)) {
+	sem := make(chan struct{}, maxConcurrentQueries)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
 func (s *MetricsService) queryVictoriaMetrics(ctx context.Context, query string, timeRange models.TimeRange) (*VMQueryResult, error) {
-	u, err := url.Parse(s.config.Metrics.VictoriaMetricsURL + "/api/v1/query")
+	u, err := url.Parse(s.config.Load().Metrics.VictoriaMetricsURL + "/api/v1/query")
 	if err != nil {
 		return nil, err
 	}
@@ -117,8 +384,7 @@ func (s *MetricsService) queryVictoriaMetrics(ctx context.Context, query string,
 		return nil, err
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -132,23 +398,74 @@ func (s *MetricsService) queryVictoriaMetrics(ctx context.Context, query string,
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, err
 	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("query failed: %s: %s", result.ErrorType, result.Error)
+	}
 
 	return &result, nil
 }
 
-func (s *MetricsService) formatDuration(d time.Duration) string {
-	if d < time.Hour {
-		return fmt.Sprintf("%dm", int(d.Minutes()))
+// sampleValue parses the value of an instant-query sample. Prometheus-style
+// APIs encode values as strings ("12.5", "NaN", "+Inf"); non-finite values
+// are reported as missing.
+func sampleValue(sample []interface{}) (float64, bool) {
+	if len(sample) != 2 {
+		return 0, false
+	}
+
+	var v float64
+	switch raw := sample[1].(type) {
+	case string:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return 0, false
+		}
+		v = parsed
+	case float64:
+		v = raw
+	default:
+		return 0, false
+	}
+
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// roundCount converts an increase() sample to a request count. increase()
+// extrapolates to the window edges, so results are fractional.
+func roundCount(sample []interface{}) int64 {
+	v, ok := sampleValue(sample)
+	if !ok || v < 0 {
+		return 0
 	}
-	return fmt.Sprintf("%dh", int(d.Hours()))
+	return int64(math.Round(v))
 }
 
 type VMQueryResult struct {
-	Status string `json:"status"`
-	Data   struct {
+	Status    string   `json:"status"`
+	ErrorType string   `json:"errorType"`
+	Error     string   `json:"error"`
+	Warnings  []string `json:"warnings"`
+	IsPartial bool     `json:"isPartial"`
+	Data      struct {
 		Result []struct {
 			Metric map[string]string `json:"metric"`
 			Value  []interface{}     `json:"value"`
 		} `json:"result"`
 	} `json:"data"`
-}
\ No newline at end of file
+}
+
+// warnings returns the warnings VictoriaMetrics attached to a result,
+// prefixed with the query name
+func (r *VMQueryResult) warnings(name string) []string {
+	var out []string
+	if r.IsPartial {
+		out = append(out, fmt.Sprintf("%s: partial result, some storage nodes did not respond", name))
+	}
+	for _, w := range r.Warnings {
+		out = append(out, fmt.Sprintf("%s: %s", name, w))
+	}
+	return out
+}
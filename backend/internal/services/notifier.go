@@ -0,0 +1,498 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"waf-admin/internal/config"
+	"waf-admin/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var notificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "waf_admin_notifications_total",
+	Help: "Webhook notifications by channel and result: \"sent\", or \"dead_letter\" once retries are exhausted.",
+}, []string{"channel", "result"})
+
+// maxDeadLetters bounds the dead letters kept in memory for the API; all of
+// them are also logged
+const maxDeadLetters = 100
+
+// alertEventTypes are the event types an alert can select with its "event"
+// label; other alerts are sent as alert_firing
+var alertEventTypes = map[string]bool{
+	models.EventApplyFailed:    true,
+	models.EventDriftDetected:  true,
+	models.EventBlockRateSpike: true,
+}
+
+// Notifier sends events to the webhook channels in the notifications config.
+// Notify queues an event for every subscribed channel; each channel has its
+// own queue and worker, so a slow or failing channel only delays its own
+// events. Audit log entries arrive through AuditService; alerts are polled
+// from vmalert and sent once when they start firing, so silenced alerts are
+// not sent.
+type Notifier struct {
+	config        atomic.Pointer[config.Config]
+	logger        *logrus.Logger
+	client        *http.Client
+	alertsService *AlertsService
+	queueSize     int
+
+	// workersMutex guards workers and ctx, which is set by Run; workers
+	// created before Run start with it
+	workersMutex sync.Mutex
+	workers      map[string]*channelWorker
+	ctx          context.Context
+
+	mutex       sync.Mutex
+	deadLetters []models.DeadLetter
+
+	// fileMutex keeps lines written to the dead-letter file by different
+	// channel workers whole, without holding mutex during the write
+	fileMutex sync.Mutex
+}
+
+// channelWorker delivers the events queued for one channel in order
+type channelWorker struct {
+	queue  chan models.NotificationEvent
+	cancel context.CancelFunc
+}
+
+// NewNotifier creates a notifier. The per-channel queue size is fixed at
+// startup.
+func NewNotifier(alertsService *AlertsService, cfg *config.Config, logger *logrus.Logger) *Notifier {
+	n := &Notifier{
+		logger:        logger,
+		client:        newUpstreamClient(upstreamWebhook),
+		alertsService: alertsService,
+		queueSize:     cfg.Notifications.QueueSize,
+		workers:       make(map[string]*channelWorker),
+	}
+	n.config.Store(cfg)
+	n.syncWorkers(cfg)
+	return n
+}
+
+// UpdateConfig swaps in a reloaded configuration, starting workers for new
+// channels and stopping those of removed ones
+func (n *Notifier) UpdateConfig(cfg *config.Config) {
+	n.config.Store(cfg)
+	n.syncWorkers(cfg)
+}
+
+// Notify queues an event for each subscribed channel without blocking. When
+// a channel's queue is full the event goes straight to the dead-letter log
+// for that channel.
+func (n *Notifier) Notify(event models.NotificationEvent) {
+	channels := n.config.Load().Notifications.Channels
+	if len(channels) == 0 {
+		return
+	}
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	n.workersMutex.Lock()
+	defer n.workersMutex.Unlock()
+	for _, ch := range channels {
+		if !subscribed(ch, event.Type) {
+			continue
+		}
+		worker, ok := n.workers[ch.Name]
+		if !ok {
+			continue
+		}
+		select {
+		case worker.queue <- event:
+		default:
+			n.deadLetter(ch.Name, event, 0, fmt.Errorf("notification queue is full"))
+		}
+	}
+}
+
+// NotifyAudit sends an audit log entry as a policy_changed event for WAF
+// policies, or config_changed for any other change
+func (n *Notifier) NotifyAudit(auditLog models.AuditLog) {
+	// Exports read the logs and change nothing
+	if auditLog.Action == "EXPORT_LOGS" {
+		return
+	}
+	event := models.NotificationEvent{
+		Type:      models.EventConfigChanged,
+		Severity:  "info",
+		Title:     fmt.Sprintf("%s %s changed", strings.ReplaceAll(auditLog.Resource, "_", " "), auditLog.ResourceID),
+		Message:   fmt.Sprintf("%s by %s", auditLog.Action, auditLog.User),
+		User:      auditLog.User,
+		Details:   auditLog,
+		Timestamp: auditLog.Timestamp,
+	}
+	if auditLog.Resource == "waf_policy" {
+		event.Type = models.EventPolicyChanged
+		event.Title = "WAF policy changed: " + auditLog.ResourceID
+		// Policy keys are namespace/host
+		if i := strings.LastIndex(auditLog.ResourceID, "/"); i >= 0 {
+			event.Host = auditLog.ResourceID[i+1:]
+		}
+	}
+	n.Notify(event)
+}
+
+// GetDeadLetters returns the most recent undeliverable notifications,
+// newest first
+func (n *Notifier) GetDeadLetters() []models.DeadLetter {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	letters := make([]models.DeadLetter, 0, len(n.deadLetters))
+	for i := len(n.deadLetters) - 1; i >= 0; i-- {
+		letters = append(letters, n.deadLetters[i])
+	}
+	return letters
+}
+
+// Run starts the channel workers and polls for new alerts until ctx is
+// cancelled
+func (n *Notifier) Run(ctx context.Context) {
+	n.workersMutex.Lock()
+	n.ctx = ctx
+	for name, worker := range n.workers {
+		n.startWorker(name, worker)
+	}
+	n.workersMutex.Unlock()
+
+	n.watchAlerts(ctx)
+}
+
+// syncWorkers gives every configured channel a worker and stops the workers
+// of channels that were removed. Events still queued for a removed channel
+// are dropped.
+func (n *Notifier) syncWorkers(cfg *config.Config) {
+	n.workersMutex.Lock()
+	defer n.workersMutex.Unlock()
+
+	configured := make(map[string]bool, len(cfg.Notifications.Channels))
+	for _, ch := range cfg.Notifications.Channels {
+		configured[ch.Name] = true
+		if _, ok := n.workers[ch.Name]; ok {
+			continue
+		}
+		worker := &channelWorker{queue: make(chan models.NotificationEvent, n.queueSize)}
+		n.workers[ch.Name] = worker
+		if n.ctx != nil {
+			n.startWorker(ch.Name, worker)
+		}
+	}
+	for name, worker := range n.workers {
+		if configured[name] {
+			continue
+		}
+		if worker.cancel != nil {
+			worker.cancel()
+		}
+		if dropped := len(worker.queue); dropped > 0 {
+			n.logger.Warnf("Notification channel %s was removed, dropping %d queued events", name, dropped)
+		}
+		delete(n.workers, name)
+	}
+}
+
+// startWorker must be called with workersMutex held
+func (n *Notifier) startWorker(name string, worker *channelWorker) {
+	ctx, cancel := context.WithCancel(n.ctx)
+	worker.cancel = cancel
+	go n.runWorker(ctx, name, worker.queue)
+}
+
+// runWorker delivers one channel's events in order, using the channel's
+// current settings for each
+func (n *Notifier) runWorker(ctx context.Context, name string, queue <-chan models.NotificationEvent) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-queue:
+			ch, ok := n.channel(name)
+			if !ok {
+				return
+			}
+			n.deliver(ctx, ch, event)
+		}
+	}
+}
+
+func (n *Notifier) channel(name string) (config.NotificationChannel, bool) {
+	for _, ch := range n.config.Load().Notifications.Channels {
+		if ch.Name == name {
+			return ch, true
+		}
+	}
+	return config.NotificationChannel{}, false
+}
+
+// watchAlerts sends an event for every alert that is firing now but was not
+// on the previous poll. Alerts already firing when polling starts are not
+// sent, so restarts do not repeat notifications.
+func (n *Notifier) watchAlerts(ctx context.Context) {
+	var seen map[string]bool
+
+	for {
+		cfg := n.config.Load()
+		interval := cfg.Notifications.AlertPollInterval
+		wait := interval
+		if wait <= 0 {
+			wait = 30 * time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if interval <= 0 || len(cfg.Notifications.Channels) == 0 || cfg.Metrics.VmalertURL == "" {
+			seen = nil
+			continue
+		}
+
+		alerts, err := n.alertsService.GetAlerts(ctx, models.AlertFilter{State: "firing"})
+		if err != nil {
+			n.logger.Warnf("Failed to get alerts for notifications: %v", err)
+			continue
+		}
+
+		current := make(map[string]bool, len(alerts))
+		for _, alert := range alerts {
+			current[alert.ID] = true
+			if seen != nil && !seen[alert.ID] {
+				n.Notify(alertEvent(alert))
+			}
+		}
+		seen = current
+	}
+}
+
+func alertEvent(alert models.Alert) models.NotificationEvent {
+	event := models.NotificationEvent{
+		Type:     models.EventAlertFiring,
+		Severity: alert.Labels["severity"],
+		Title:    alert.Name,
+		Message:  alert.Annotations["description"],
+		Host:     alert.Labels["host"],
+		Labels:   alert.Labels,
+		Details:  alert,
+	}
+	if alertEventTypes[alert.Labels["event"]] {
+		event.Type = alert.Labels["event"]
+	}
+	if event.Severity == "" {
+		event.Severity = "warning"
+	}
+	if event.Host != "" {
+		event.Title += " on " + event.Host
+	}
+	if event.Message == "" {
+		event.Message = alert.Annotations["summary"]
+	}
+	return event
+}
+
+func subscribed(ch config.NotificationChannel, eventType string) bool {
+	if len(ch.Events) == 0 {
+		return true
+	}
+	for _, e := range ch.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver sends an event to one channel, retrying network errors, 429 and
+// 5xx responses with exponential backoff. Other failures are not retried.
+func (n *Notifier) deliver(ctx context.Context, ch config.NotificationChannel, event models.NotificationEvent) {
+	body, err := renderPayload(ch, event)
+	if err != nil {
+		n.deadLetter(ch.Name, event, 0, fmt.Errorf("failed to render payload: %w", err))
+		return
+	}
+
+	cfg := n.config.Load().Notifications
+	backoff := cfg.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := n.send(ctx, ch, event, body, cfg.Timeout)
+		if err == nil {
+			notificationsTotal.WithLabelValues(ch.Name, "sent").Inc()
+			return
+		}
+		if !retry || attempt > cfg.MaxRetries {
+			n.deadLetter(ch.Name, event, attempt, err)
+			return
+		}
+
+		n.logger.Warnf("Webhook %s failed on attempt %d, retrying in %s: %v", ch.Name, attempt, backoff, err)
+		select {
+		case <-ctx.Done():
+			n.deadLetter(ch.Name, event, attempt, err)
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > cfg.MaxRetryBackoff {
+			backoff = cfg.MaxRetryBackoff
+		}
+	}
+}
+
+// send posts one attempt and reports whether a failure is worth retrying.
+// Signed requests carry X-WAF-Admin-Signature, the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the channel secret, where timestamp is the
+// X-WAF-Admin-Timestamp header, so receivers can reject replays.
+func (n *Notifier) send(ctx context.Context, ch config.NotificationChannel, event models.NotificationEvent, body []byte, timeout time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", ch.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "waf-admin")
+	req.Header.Set("X-WAF-Admin-Event", event.Type)
+	req.Header.Set("X-WAF-Admin-Delivery", event.ID)
+	if ch.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(ch.Secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		req.Header.Set("X-WAF-Admin-Timestamp", timestamp)
+		req.Header.Set("X-WAF-Admin-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	if text := strings.TrimSpace(string(msg)); text != "" {
+		return retry, fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, text)
+	}
+	return retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+}
+
+// renderPayload builds the request body: the channel template when one is
+// set, otherwise a Slack message, a Teams message card or, for generic
+// webhooks, the event as JSON
+func renderPayload(ch config.NotificationChannel, event models.NotificationEvent) ([]byte, error) {
+	if ch.Template != "" {
+		tmpl, err := template.New(ch.Name).Funcs(config.NotificationTemplateFuncs).Parse(ch.Template)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, event); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	switch ch.Type {
+	case "slack":
+		return json.Marshal(map[string]string{
+			"text": fmt.Sprintf("*[%s] %s*\n%s", strings.ToUpper(event.Severity), event.Title, event.Message),
+		})
+	case "teams":
+		color := "0078D7"
+		switch event.Severity {
+		case "critical":
+			color = "D13438"
+		case "warning":
+			color = "FFB900"
+		}
+		return json.Marshal(map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    event.Title,
+			"title":      event.Title,
+			"text":       event.Message,
+			"themeColor": color,
+		})
+	default:
+		return json.Marshal(event)
+	}
+}
+
+// deadLetter logs an undeliverable notification in the same structured form
+// as audit logs, keeps it for the API and appends it to the dead-letter file
+// when one is configured
+func (n *Notifier) deadLetter(channel string, event models.NotificationEvent, attempts int, err error) {
+	letter := models.DeadLetter{
+		Channel:   channel,
+		Event:     event,
+		Attempts:  attempts,
+		Error:     err.Error(),
+		Timestamp: time.Now(),
+	}
+	notificationsTotal.WithLabelValues(channel, "dead_letter").Inc()
+
+	data, jsonErr := json.Marshal(letter)
+	if jsonErr != nil {
+		n.logger.Errorf("Failed to marshal dead letter: %v", jsonErr)
+		return
+	}
+	n.logger.WithFields(logrus.Fields{
+		"type":             "notification_dead_letter",
+		"dead_letter_data": string(data),
+	}).Error("Notification could not be delivered")
+
+	n.mutex.Lock()
+	n.deadLetters = append(n.deadLetters, letter)
+	if len(n.deadLetters) > maxDeadLetters {
+		n.deadLetters = n.deadLetters[len(n.deadLetters)-maxDeadLetters:]
+	}
+	n.mutex.Unlock()
+
+	path := n.config.Load().Notifications.DeadLetterFile
+	if path == "" {
+		return
+	}
+	n.fileMutex.Lock()
+	defer n.fileMutex.Unlock()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		n.logger.Errorf("Failed to open dead-letter file: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		n.logger.Errorf("Failed to write dead-letter file: %v", err)
+	}
+}
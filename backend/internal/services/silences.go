@@ -0,0 +1,707 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"waf-admin/internal/auth"
+	"waf-admin/internal/config"
+	"waf-admin/internal/k8s"
+	"waf-admin/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	ErrSilenceNotFound         = errors.New("silence not found")
+	ErrInvalidSilence          = errors.New("invalid silence")
+	ErrSilenceConflict         = errors.New("silences were modified concurrently, retry the request")
+	ErrAcknowledgementNotFound = errors.New("alert is not acknowledged")
+)
+
+const (
+	silencesStoreKey = "silences.json"
+	// acknowledgementsStoreKey holds alert acknowledgements, which are kept
+	// in the silences ConfigMap even when silences live in Alertmanager
+	acknowledgementsStoreKey = "acknowledgements.json"
+	// silenceRetention is how long expired local silences are kept for
+	// reference, matching Alertmanager's default data retention
+	silenceRetention = 120 * time.Hour
+)
+
+var silenceStates = []string{models.SilenceActive, models.SilencePending, models.SilenceExpired}
+
+// SilencesService manages silences. When metrics.alertmanager_url is set
+// every call is proxied to Alertmanager's v2 API; otherwise silences are
+// stored in a ConfigMap and only applied to the alerts served by this API.
+type SilencesService struct {
+	k8sClient    *k8s.Client
+	config       atomic.Pointer[config.Config]
+	logger       *logrus.Logger
+	client       *http.Client
+	auditService *AuditService
+
+	// mutex serializes changes to the local store from this replica; the
+	// ConfigMap's resourceVersion guards against writes from other replicas
+	mutex sync.Mutex
+}
+
+func NewSilencesService(k8sClient *k8s.Client, cfg *config.Config, logger *logrus.Logger) *SilencesService {
+	s := &SilencesService{
+		k8sClient: k8sClient,
+		logger:    logger,
+		client:    newUpstreamClient(upstreamAlertmanager),
+	}
+	s.config.Store(cfg)
+	return s
+}
+
+// UpdateConfig swaps in a reloaded configuration
+func (s *SilencesService) UpdateConfig(cfg *config.Config) {
+	s.config.Store(cfg)
+}
+
+func (s *SilencesService) SetAuditService(auditService *AuditService) {
+	s.auditService = auditService
+}
+
+// ValidateSilenceState checks a state filter; empty matches every state
+func ValidateSilenceState(state string) error {
+	if state == "" {
+		return nil
+	}
+	for _, st := range silenceStates {
+		if state == st {
+			return nil
+		}
+	}
+	return fmt.Errorf("state must be one of %s", strings.Join(silenceStates, ", "))
+}
+
+// ListSilences returns the silences in the given state, or all of them when
+// state is empty: active first, then pending, then expired, the most
+// recently started first within each state
+func (s *SilencesService) ListSilences(ctx context.Context, state string) ([]models.Silence, error) {
+	var silences []models.Silence
+	var err error
+	if s.alertmanagerURL() != "" {
+		silences, err = s.amList(ctx)
+	} else {
+		_, silences, err = s.load(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	filtered := make([]models.Silence, 0, len(silences))
+	for _, silence := range silences {
+		if silence.State == "" {
+			silence.State = silenceState(silence, now)
+		}
+		if state == "" || silence.State == state {
+			filtered = append(filtered, silence)
+		}
+	}
+
+	rank := map[string]int{models.SilenceActive: 0, models.SilencePending: 1, models.SilenceExpired: 2}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		if filtered[i].State != filtered[j].State {
+			return rank[filtered[i].State] < rank[filtered[j].State]
+		}
+		return filtered[i].StartsAt.After(filtered[j].StartsAt)
+	})
+	return filtered, nil
+}
+
+// CreateSilence adds a silence created by the requesting user
+func (s *SilencesService) CreateSilence(ctx context.Context, req models.SilenceRequest) (*models.Silence, error) {
+	now := time.Now()
+	silence, err := newSilence(req, now)
+	if err != nil {
+		return nil, err
+	}
+	silence.CreatedBy = s.auditUser(ctx)
+
+	if s.alertmanagerURL() != "" {
+		id, err := s.amCreate(ctx, silence)
+		if err != nil {
+			return nil, err
+		}
+		silence.ID = id
+		s.audit(ctx, "CREATE_SILENCE", "silence", silence.ID, nil, silence)
+		return &silence, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	configMap, silences, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	silence.ID = uuid.New().String()
+	silences = append(silences, silence)
+	if err := s.save(ctx, configMap, silences, now); err != nil {
+		return nil, err
+	}
+	s.audit(ctx, "CREATE_SILENCE", "silence", silence.ID, nil, silence)
+	return &silence, nil
+}
+
+// ExpireSilence ends a silence now. Expired silences cannot be expired again.
+func (s *SilencesService) ExpireSilence(ctx context.Context, id string) error {
+	if s.alertmanagerURL() != "" {
+		old, err := s.amGet(ctx, id)
+		if err != nil {
+			return err
+		}
+		if old.State == models.SilenceExpired {
+			return fmt.Errorf("%w: silence %s has already expired", ErrInvalidSilence, id)
+		}
+		if err := s.amExpire(ctx, id); err != nil {
+			return err
+		}
+		s.audit(ctx, "EXPIRE_SILENCE", "silence", id, old, nil)
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	configMap, silences, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range silences {
+		if silences[i].ID != id {
+			continue
+		}
+		old := silences[i]
+		old.State = silenceState(old, now)
+		if old.State == models.SilenceExpired {
+			return fmt.Errorf("%w: silence %s has already expired", ErrInvalidSilence, id)
+		}
+		// Like Alertmanager, a pending silence ends before it ever started
+		if old.State == models.SilencePending {
+			silences[i].StartsAt = now
+		}
+		silences[i].EndsAt = now
+		silences[i].UpdatedAt = now
+		if err := s.save(ctx, configMap, silences, now); err != nil {
+			return err
+		}
+		updated := silences[i]
+		updated.State = models.SilenceExpired
+		s.audit(ctx, "EXPIRE_SILENCE", "silence", id, old, updated)
+		return nil
+	}
+	return ErrSilenceNotFound
+}
+
+// ActiveSilences returns the silences currently muting alerts
+func (s *SilencesService) ActiveSilences(ctx context.Context) ([]models.Silence, error) {
+	return s.ListSilences(ctx, models.SilenceActive)
+}
+
+// newSilence validates a request and builds the silence it describes
+func newSilence(req models.SilenceRequest, now time.Time) (models.Silence, error) {
+	silence := models.Silence{
+		Comment:   strings.TrimSpace(req.Comment),
+		StartsAt:  now,
+		UpdatedAt: now,
+	}
+	if silence.Comment == "" {
+		return silence, fmt.Errorf("%w: comment must not be empty", ErrInvalidSilence)
+	}
+	if len(req.Matchers) == 0 {
+		return silence, fmt.Errorf("%w: at least one matcher is required", ErrInvalidSilence)
+	}
+
+	matchesEverything := true
+	for _, m := range req.Matchers {
+		if !identifierPattern.MatchString(m.Name) {
+			return silence, fmt.Errorf("%w: invalid label name %q", ErrInvalidSilence, m.Name)
+		}
+		if m.IsEqual == nil {
+			isEqual := true
+			m.IsEqual = &isEqual
+		}
+		if m.IsRegex {
+			if _, err := regexp.Compile(anchoredPattern(m.Value)); err != nil {
+				return silence, fmt.Errorf("%w: invalid regular expression for %s: %v", ErrInvalidSilence, m.Name, err)
+			}
+		}
+		if !matcherMatches(m, "") {
+			matchesEverything = false
+		}
+		silence.Matchers = append(silence.Matchers, m)
+	}
+	// Alertmanager rejects silences that would mute every alert; do the same
+	// locally so both modes accept the same requests
+	if matchesEverything {
+		return silence, fmt.Errorf("%w: at least one matcher must not match the empty string", ErrInvalidSilence)
+	}
+
+	if req.StartsAt != nil {
+		silence.StartsAt = *req.StartsAt
+	}
+	switch {
+	case req.EndsAt != nil && req.Duration != "":
+		return silence, fmt.Errorf("%w: set either ends_at or duration, not both", ErrInvalidSilence)
+	case req.EndsAt != nil:
+		silence.EndsAt = *req.EndsAt
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return silence, fmt.Errorf("%w: duration must be a positive duration such as 2h, got %q", ErrInvalidSilence, req.Duration)
+		}
+		silence.EndsAt = silence.StartsAt.Add(d)
+	default:
+		return silence, fmt.Errorf("%w: ends_at or duration is required", ErrInvalidSilence)
+	}
+	if !silence.EndsAt.After(silence.StartsAt) {
+		return silence, fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidSilence)
+	}
+	if !silence.EndsAt.After(now) {
+		return silence, fmt.Errorf("%w: ends_at must be in the future", ErrInvalidSilence)
+	}
+	silence.State = silenceState(silence, now)
+	return silence, nil
+}
+
+func silenceState(silence models.Silence, now time.Time) string {
+	switch {
+	case !now.Before(silence.EndsAt):
+		return models.SilenceExpired
+	case now.Before(silence.StartsAt):
+		return models.SilencePending
+	default:
+		return models.SilenceActive
+	}
+}
+
+// silencedBy returns the IDs of the silences whose matchers all match labels
+func silencedBy(silences []models.Silence, labels map[string]string) []string {
+	var ids []string
+	for _, silence := range silences {
+		matched := true
+		for _, m := range silence.Matchers {
+			if !matcherMatches(m, labels[m.Name]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			ids = append(ids, silence.ID)
+		}
+	}
+	return ids
+}
+
+// matcherMatches applies one matcher to a label value; a missing label
+// matches as the empty string, as in Alertmanager
+func matcherMatches(m models.SilenceMatcher, value string) bool {
+	matched := value == m.Value
+	if m.IsRegex {
+		re, err := regexp.Compile(anchoredPattern(m.Value))
+		if err != nil {
+			return false
+		}
+		matched = re.MatchString(value)
+	}
+	if m.IsEqual != nil && !*m.IsEqual {
+		return !matched
+	}
+	return matched
+}
+
+// anchoredPattern makes a regex matcher match whole label values
+func anchoredPattern(pattern string) string {
+	return "^(?:" + pattern + ")$"
+}
+
+// ConfigMapRef returns the namespace and name of the local silences
+// ConfigMap
+func (s *SilencesService) ConfigMapRef() (namespace, name string) {
+	cfg := s.config.Load()
+	return cfg.Kubernetes.Namespace, cfg.Metrics.Silences.ConfigMapName
+}
+
+// load reads the local silences. A missing ConfigMap is returned as a new,
+// unsaved object with no silences.
+func (s *SilencesService) load(ctx context.Context) (*corev1.ConfigMap, []models.Silence, error) {
+	namespace, name := s.ConfigMapRef()
+	configMap, err := s.k8sClient.GetConfigMap(ctx, namespace, name)
+	if apierrors.IsNotFound(err) {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					"app": "waf-admin",
+				},
+			},
+		}, []models.Silence{}, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get silences configmap: %w", err)
+	}
+
+	silences := []models.Silence{}
+	if data := configMap.Data[silencesStoreKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &silences); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode silences: %w", err)
+		}
+	}
+	return configMap, silences, nil
+}
+
+// save writes the local silences, dropping those that expired more than
+// silenceRetention ago. States are computed on read, so they are not stored.
+func (s *SilencesService) save(ctx context.Context, configMap *corev1.ConfigMap, silences []models.Silence, now time.Time) error {
+	kept := make([]models.Silence, 0, len(silences))
+	for _, silence := range silences {
+		if now.Sub(silence.EndsAt) > silenceRetention {
+			continue
+		}
+		silence.State = ""
+		kept = append(kept, silence)
+	}
+
+	store, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal silences: %w", err)
+	}
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[silencesStoreKey] = string(store)
+	return s.write(ctx, configMap)
+}
+
+// write creates or updates the silences ConfigMap
+func (s *SilencesService) write(ctx context.Context, configMap *corev1.ConfigMap) error {
+	var err error
+	if configMap.ResourceVersion == "" {
+		_, err = s.k8sClient.CreateConfigMap(ctx, configMap.Namespace, configMap)
+	} else {
+		err = s.k8sClient.UpdateConfigMap(ctx, configMap.Namespace, configMap)
+	}
+	if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+		return ErrSilenceConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save silences configmap: %w", err)
+	}
+	return nil
+}
+
+// Acknowledgements returns the stored alert acknowledgements keyed by alert
+// ID. Some may belong to alerts that have since resolved; callers match
+// them against the alert's start time.
+func (s *SilencesService) Acknowledgements(ctx context.Context) (map[string]models.AlertAcknowledgement, error) {
+	configMap, _, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	acks, err := decodeAcknowledgements(configMap)
+	if err != nil {
+		return nil, err
+	}
+	byAlert := make(map[string]models.AlertAcknowledgement, len(acks))
+	for _, ack := range acks {
+		byAlert[ack.AlertID] = ack
+	}
+	return byAlert, nil
+}
+
+// acknowledge stores ack, replacing an earlier acknowledgement of the same
+// alert. Acknowledgements of alerts that are no longer active are dropped.
+func (s *SilencesService) acknowledge(ctx context.Context, ack models.AlertAcknowledgement, active []models.Alert) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	configMap, _, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	acks, err := decodeAcknowledgements(configMap)
+	if err != nil {
+		return err
+	}
+	var old *models.AlertAcknowledgement
+	kept := []models.AlertAcknowledgement{ack}
+	for _, a := range acks {
+		if a.AlertID == ack.AlertID {
+			a := a
+			old = &a
+			continue
+		}
+		if acknowledgementApplies(a, active) {
+			kept = append(kept, a)
+		}
+	}
+	if err := s.saveAcknowledgements(ctx, configMap, kept); err != nil {
+		return err
+	}
+	s.audit(ctx, "ACKNOWLEDGE_ALERT", "alert", ack.AlertID, old, ack)
+	return nil
+}
+
+// unacknowledge removes the acknowledgement of an alert
+func (s *SilencesService) unacknowledge(ctx context.Context, alertID string, active []models.Alert) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	configMap, _, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	acks, err := decodeAcknowledgements(configMap)
+	if err != nil {
+		return err
+	}
+	var old *models.AlertAcknowledgement
+	kept := []models.AlertAcknowledgement{}
+	for _, a := range acks {
+		if a.AlertID == alertID {
+			a := a
+			old = &a
+			continue
+		}
+		if acknowledgementApplies(a, active) {
+			kept = append(kept, a)
+		}
+	}
+	if old == nil || !acknowledgementApplies(*old, active) {
+		return ErrAcknowledgementNotFound
+	}
+	if err := s.saveAcknowledgements(ctx, configMap, kept); err != nil {
+		return err
+	}
+	s.audit(ctx, "UNACKNOWLEDGE_ALERT", "alert", alertID, old, nil)
+	return nil
+}
+
+func (s *SilencesService) saveAcknowledgements(ctx context.Context, configMap *corev1.ConfigMap, acks []models.AlertAcknowledgement) error {
+	store, err := json.MarshalIndent(acks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal acknowledgements: %w", err)
+	}
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data[acknowledgementsStoreKey] = string(store)
+	return s.write(ctx, configMap)
+}
+
+func decodeAcknowledgements(configMap *corev1.ConfigMap) ([]models.AlertAcknowledgement, error) {
+	acks := []models.AlertAcknowledgement{}
+	if data := configMap.Data[acknowledgementsStoreKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &acks); err != nil {
+			return nil, fmt.Errorf("failed to decode acknowledgements: %w", err)
+		}
+	}
+	return acks, nil
+}
+
+// acknowledgementApplies reports whether ack belongs to one of the active
+// alerts, as opposed to an earlier firing of the same alert
+func acknowledgementApplies(ack models.AlertAcknowledgement, active []models.Alert) bool {
+	for _, alert := range active {
+		if alert.ID == ack.AlertID && alert.StartsAt.Equal(ack.AlertStartsAt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SilencesService) audit(ctx context.Context, action, resource, id string, oldValue, newValue interface{}) {
+	if s.auditService == nil {
+		return
+	}
+	auditLog := s.auditService.CreateAuditLog(action, resource, id, s.auditUser(ctx), "", "", oldValue, newValue)
+	if err := s.auditService.LogChange(ctx, auditLog); err != nil {
+		s.logger.Warnf("Failed to log audit change: %v", err)
+	}
+}
+
+func (s *SilencesService) auditUser(ctx context.Context) string {
+	if user, ok := auth.UserFromContext(ctx); ok && user.Name != "" {
+		return user.Name
+	}
+	return "system"
+}
+
+// UsesAlertmanager reports whether silences are managed by Alertmanager
+// rather than stored in the local ConfigMap
+func (s *SilencesService) UsesAlertmanager() bool {
+	return s.alertmanagerURL() != ""
+}
+
+func (s *SilencesService) alertmanagerURL() string {
+	return strings.TrimSuffix(s.config.Load().Metrics.AlertmanagerURL, "/")
+}
+
+// amSilence is a silence in Alertmanager's v2 API
+type amSilence struct {
+	ID        string      `json:"id,omitempty"`
+	Matchers  []amMatcher `json:"matchers"`
+	StartsAt  time.Time   `json:"startsAt"`
+	EndsAt    time.Time   `json:"endsAt"`
+	CreatedBy string      `json:"createdBy"`
+	Comment   string      `json:"comment"`
+	UpdatedAt *time.Time  `json:"updatedAt,omitempty"`
+	Status    *struct {
+		State string `json:"state"`
+	} `json:"status,omitempty"`
+}
+
+type amMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual *bool  `json:"isEqual,omitempty"`
+}
+
+func (a amSilence) toModel() models.Silence {
+	silence := models.Silence{
+		ID:        a.ID,
+		Matchers:  make([]models.SilenceMatcher, 0, len(a.Matchers)),
+		StartsAt:  a.StartsAt,
+		EndsAt:    a.EndsAt,
+		CreatedBy: a.CreatedBy,
+		Comment:   a.Comment,
+	}
+	for _, m := range a.Matchers {
+		isEqual := m.IsEqual == nil || *m.IsEqual
+		silence.Matchers = append(silence.Matchers, models.SilenceMatcher{
+			Name:    m.Name,
+			Value:   m.Value,
+			IsRegex: m.IsRegex,
+			IsEqual: &isEqual,
+		})
+	}
+	if a.UpdatedAt != nil {
+		silence.UpdatedAt = *a.UpdatedAt
+	}
+	if a.Status != nil {
+		silence.State = a.Status.State
+	}
+	return silence
+}
+
+func (s *SilencesService) amList(ctx context.Context) ([]models.Silence, error) {
+	var data []amSilence
+	if err := s.amDo(ctx, "GET", "/api/v2/silences", nil, &data); err != nil {
+		return nil, err
+	}
+	silences := make([]models.Silence, 0, len(data))
+	for _, a := range data {
+		silences = append(silences, a.toModel())
+	}
+	return silences, nil
+}
+
+func (s *SilencesService) amGet(ctx context.Context, id string) (models.Silence, error) {
+	var data amSilence
+	if err := s.amDo(ctx, "GET", "/api/v2/silence/"+url.PathEscape(id), nil, &data); err != nil {
+		return models.Silence{}, err
+	}
+	return data.toModel(), nil
+}
+
+func (s *SilencesService) amCreate(ctx context.Context, silence models.Silence) (string, error) {
+	body := amSilence{
+		StartsAt:  silence.StartsAt,
+		EndsAt:    silence.EndsAt,
+		CreatedBy: silence.CreatedBy,
+		Comment:   silence.Comment,
+	}
+	for _, m := range silence.Matchers {
+		body.Matchers = append(body.Matchers, amMatcher{
+			Name:    m.Name,
+			Value:   m.Value,
+			IsRegex: m.IsRegex,
+			IsEqual: m.IsEqual,
+		})
+	}
+
+	var result struct {
+		SilenceID string `json:"silenceID"`
+	}
+	if err := s.amDo(ctx, "POST", "/api/v2/silences", body, &result); err != nil {
+		return "", err
+	}
+	return result.SilenceID, nil
+}
+
+func (s *SilencesService) amExpire(ctx context.Context, id string) error {
+	return s.amDo(ctx, "DELETE", "/api/v2/silence/"+url.PathEscape(id), nil, nil)
+}
+
+// amDo calls an Alertmanager API endpoint. A 400 is reported as an invalid
+// silence and a 404 as a missing one.
+func (s *SilencesService) amDo(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.alertmanagerURL()+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("alertmanager request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusBadRequest:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: %s", ErrInvalidSilence, strings.Trim(strings.TrimSpace(string(msg)), `"`))
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrSilenceNotFound
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("alertmanager returned status %d: %s", resp.StatusCode, msg)
+	}
+
+	if out == nil {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 512))
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode alertmanager response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"waf-admin/internal/models"
+)
+
+const (
+	// maxTimeSeriesPoints bounds the points per series; longer ranges get a
+	// coarser step so charts stay cheap to query and render
+	maxTimeSeriesPoints = 300
+	minTimeSeriesStep   = 15 * time.Second
+)
+
+// timeSeriesSteps are the resolutions a step is rounded up to, so that
+// nearby ranges produce the same, human-friendly step
+var timeSeriesSteps = []time.Duration{
+	15 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	2 * time.Minute,
+	5 * time.Minute,
+	10 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	2 * time.Hour,
+	3 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+}
+
+// ErrInvalidTimeSeriesQuery is returned for a time range or step that
+// cannot be charted
+var ErrInvalidTimeSeriesQuery = errors.New("invalid time series query")
+
+// timeSeriesQueries are the per-host series returned for dashboard charts,
+// keyed by metric name. %[1]s is the label selector and %[2]s the rate window.
+//
+// blocked_ratio has two queries, as the summary's waf_blocked does: the
+// ModSecurity one divides waf_blocked_total by the requests, counting hosts
+// without blocks as 0, and yields nothing until the exporter has recorded a
+// block. Only then is the 403 ratio used, since a 403 can come from auth or
+// the upstream and a custom deny status is not a 403 at all.
+var timeSeriesQueries = []struct {
+	metric string
+	query  string
+	// source is set for the alternative blocked_ratio queries; the first
+	// with data is used
+	source string
+}{
+	{"requests", `sum(rate(nginx_ingress_controller_requests{%[1]s}[%[2]s])) by (host)`, ""},
+	{"status_4xx", `sum(rate(nginx_ingress_controller_requests{%[1]s,status=~"4.."}[%[2]s])) by (host)`, ""},
+	{"status_5xx", `sum(rate(nginx_ingress_controller_requests{%[1]s,status=~"5.."}[%[2]s])) by (host)`, ""},
+	{"status_403", `sum(rate(nginx_ingress_controller_requests{%[1]s,status="403"}[%[2]s])) by (host)`, ""},
+	{"blocked_ratio", `(sum(rate(waf_blocked_total{%[1]s}[%[2]s])) by (host) or 0 * sum(rate(nginx_ingress_controller_requests{%[1]s}[%[2]s])) by (host)) / sum(rate(nginx_ingress_controller_requests{%[1]s}[%[2]s])) by (host) and on() count(waf_blocked_total) > 0`, models.BlockedSourceModSecurity},
+	{"blocked_ratio", `sum(rate(nginx_ingress_controller_requests{%[1]s,status="403"}[%[2]s])) by (host) / sum(rate(nginx_ingress_controller_requests{%[1]s}[%[2]s])) by (host)`, models.BlockedSourceStatus403},
+}
+
+// selectStep picks the query resolution for a range: the smallest step from
+// timeSeriesSteps that keeps the series under maxTimeSeriesPoints
+func selectStep(d time.Duration) time.Duration {
+	for _, step := range timeSeriesSteps {
+		if d/step <= maxTimeSeriesPoints {
+			return step
+		}
+	}
+	// Beyond a year of data fall back to whole days
+	days := time.Duration(math.Ceil(float64(d) / float64(maxTimeSeriesPoints) / float64(24*time.Hour)))
+	return days * 24 * time.Hour
+}
+
+// GetTimeSeries returns per-host request, status and blocked-ratio series for
+// the dashboard charts. host restricts the series to one host when set; step
+// overrides the automatic resolution when positive.
+func (s *MetricsService) GetTimeSeries(ctx context.Context, timeRange models.TimeRange, host string, step time.Duration) (*models.TimeSeriesResult, error) {
+	span := timeRange.End.Sub(timeRange.Start)
+	if span <= 0 {
+		return nil, fmt.Errorf("%w: time range end must be after start", ErrInvalidTimeSeriesQuery)
+	}
+	if step <= 0 {
+		step = selectStep(span)
+	}
+	if step < minTimeSeriesStep {
+		step = minTimeSeriesStep
+	}
+	if span/step > maxTimeSeriesPoints*10 {
+		return nil, fmt.Errorf("%w: step %s is too small for a %s range", ErrInvalidTimeSeriesQuery, step, span)
+	}
+
+	// Align the range to the step so nearby requests query the same samples
+	// and share a cache entry
+	aligned := models.TimeRange{
+		Start: timeRange.Start.Truncate(step),
+		End:   timeRange.End.Truncate(step),
+	}
+	if aligned.End.Before(timeRange.End) {
+		aligned.End = aligned.End.Add(step)
+	}
+	host = normalizeHost(host)
+
+	key := fmt.Sprintf("%d|%d|%d|%s", aligned.Start.Unix(), aligned.End.Unix(), step/time.Second, host)
+	return s.seriesCache.Get(key, func() (*models.TimeSeriesResult, error) {
+		// The load is shared by every request waiting on this key, so it
+		// must not be cancelled when the first caller goes away
+		return s.loadTimeSeries(context.WithoutCancel(ctx), aligned, host, step)
+	})
+}
+
+func (s *MetricsService) loadTimeSeries(ctx context.Context, timeRange models.TimeRange, host string, step time.Duration) (*models.TimeSeriesResult, error) {
+	// A rate window equal to the step makes every point cover its whole
+	// interval, so downsampled series do not skip traffic between points
+	window := step
+	if window < time.Minute {
+		window = time.Minute
+	}
+
+	selector := `host!=""`
+	if host != "" {
+		selector = "host=" + strconv.Quote(host)
+	}
+
+	result := &models.TimeSeriesResult{
+		TimeRange: timeRange,
+		Step:      int64(step.Seconds()),
+		Series:    []models.TimeSeries{},
+	}
+
+	matrices := make([]*VMRangeResult, len(timeSeriesQueries))
+	errs := make([]error, len(timeSeriesQueries))
+	runBounded(len(timeSeriesQueries), func(i int) {
+		query := fmt.Sprintf(timeSeriesQueries[i].query, selector, promDuration(window))
+		matrices[i], errs[i] = s.queryRange(ctx, query, timeRange, step)
+	})
+
+	for i, q := range timeSeriesQueries {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("failed to query %s: %w", q.metric, errs[i])
+		}
+		if q.source != "" {
+			if result.BlockedRatioSource != "" || (q.source == models.BlockedSourceModSecurity && len(matrices[i].Data.Result) == 0) {
+				continue
+			}
+			result.BlockedRatioSource = q.source
+		}
+
+		for _, series := range matrices[i].Data.Result {
+			ts := models.TimeSeries{
+				Metric: q.metric,
+				Host:   series.Metric["host"],
+				Points: make([]models.TimeSeriesPoint, 0, len(series.Values)),
+			}
+			for _, sample := range series.Values {
+				t, v, ok := parseRangeSample(sample)
+				if !ok {
+					continue
+				}
+				ts.Points = append(ts.Points, models.TimeSeriesPoint{Timestamp: t, Value: v})
+			}
+			result.Series = append(result.Series, ts)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *MetricsService) queryRange(ctx context.Context, query string, timeRange models.TimeRange, step time.Duration) (*VMRangeResult, error) {
+	u, err := url.Parse(s.config.Load().Metrics.VictoriaMetricsURL + "/api/v1/query_range")
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	q.Set("query", query)
+	q.Set("start", strconv.FormatInt(timeRange.Start.Unix(), 10))
+	q.Set("end", strconv.FormatInt(timeRange.End.Unix(), 10))
+	q.Set("step", promDuration(step))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("victoria metrics returned status %d", resp.StatusCode)
+	}
+
+	var result VMRangeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("query failed: %s: %s", result.ErrorType, result.Error)
+	}
+
+	return &result, nil
+}
+
+// parseRangeSample decodes a [unix_seconds, "value"] pair, skipping NaN and
+// infinite values such as a blocked ratio over zero requests
+func parseRangeSample(sample []interface{}) (time.Time, float64, bool) {
+	v, ok := sampleValue(sample)
+	if !ok {
+		return time.Time{}, 0, false
+	}
+	ts, ok := sample[0].(float64)
+	if !ok {
+		return time.Time{}, 0, false
+	}
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC(), v, true
+}
+
+// promDuration formats a duration in whole seconds for PromQL
+func promDuration(d time.Duration) string {
+	return fmt.Sprintf("%ds", int64(d.Seconds()))
+}
+
+type VMRangeResult struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		Result []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][]interface{}   `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Upstream names used as the "upstream" metric label
+const (
+	upstreamVictoriaMetrics = "victoria_metrics"
+	upstreamVictoriaLogs    = "victoria_logs"
+	upstreamVmalert         = "vmalert"
+	upstreamAlertmanager    = "alertmanager"
+	upstreamWebhook         = "webhook"
+)
+
+var (
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "waf_admin_upstream_request_duration_seconds",
+		Help:    "Latency of requests to VictoriaMetrics, VictoriaLogs and other upstreams, until the response headers arrive.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"upstream"})
+	upstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "waf_admin_upstream_errors_total",
+		Help: "Upstream requests that failed, by HTTP status code or \"error\" when no response was received.",
+	}, []string{"upstream", "code"})
+)
+
+// newUpstreamClient returns an HTTP client for one upstream service whose
+// requests are recorded in the upstream metrics. Keeping enough idle
+// connections for a full batch of parallel queries avoids a new TCP
+// handshake per query on every dashboard refresh.
+func newUpstreamClient(upstream string) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 32
+	transport.MaxIdleConnsPerHost = 2 * maxConcurrentQueries
+	transport.IdleConnTimeout = 90 * time.Second
+	transport.ResponseHeaderTimeout = 30 * time.Second
+
+	return &http.Client{
+		Transport: &instrumentedTransport{upstream: upstream, next: transport},
+		Timeout:   30 * time.Second,
+	}
+}
+
+type instrumentedTransport struct {
+	upstream string
+	next     http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	upstreamDuration.WithLabelValues(t.upstream).Observe(time.Since(start).Seconds())
+
+	switch {
+	case err != nil:
+		upstreamErrors.WithLabelValues(t.upstream, "error").Inc()
+	case resp.StatusCode >= 400:
+		upstreamErrors.WithLabelValues(t.upstream, strconv.Itoa(resp.StatusCode)).Inc()
+	}
+	return resp, err
+}
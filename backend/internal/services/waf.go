@@ -3,36 +3,91 @@ package services
 import (
 	"context"
 	"fmt"
+	"math"
+	"sync/atomic"
 	"time"
 
+	"waf-admin/internal/auth"
 	"waf-admin/internal/config"
 	"waf-admin/internal/k8s"
 	"waf-admin/internal/models"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+var (
+	policiesByMode = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "waf_admin_policies",
+		Help: "WAF policies in the policy ConfigMap by mode, as of the last time it was read or written.",
+	}, []string{"mode"})
+	policyChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "waf_admin_policy_changes_total",
+		Help: "Policy changes saved to the policy ConfigMap by action.",
+	}, []string{"action"})
+	policyApplies = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "waf_admin_policy_applies_total",
+		Help: "Attempts to apply a policy to the ingress controller by strategy and result.",
+	}, []string{"strategy", "result"})
+	lastApplySuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "waf_admin_last_apply_success_timestamp_seconds",
+		Help: "Time of the last successful policy apply.",
+	})
+
+	// lastApplyUnix backs the age gauge; zero means no apply succeeded yet
+	lastApplyUnix atomic.Int64
+	_             = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "waf_admin_seconds_since_last_apply_success",
+		Help: "Seconds since the last successful policy apply, NaN until one succeeds.",
+	}, func() float64 {
+		last := lastApplyUnix.Load()
+		if last == 0 {
+			return math.NaN()
+		}
+		return time.Since(time.Unix(last, 0)).Seconds()
+	})
 )
 
 type WAFService struct {
-	k8sClient    *k8s.Client
-	config       *config.Config
-	logger       *logrus.Logger
-	auditService *AuditService
+	k8sClient     *k8s.Client
+	config        atomic.Pointer[config.Config]
+	logger        *logrus.Logger
+	auditService  *AuditService
+	authenticator *auth.Authenticator
+	notifier      *Notifier
 }
 
 func NewWAFService(k8sClient *k8s.Client, cfg *config.Config, logger *logrus.Logger) *WAFService {
-	return &WAFService{
+	s := &WAFService{
 		k8sClient: k8sClient,
-		config:    cfg,
 		logger:    logger,
 	}
+	s.config.Store(cfg)
+	return s
+}
+
+// UpdateConfig swaps in a reloaded configuration
+func (s *WAFService) UpdateConfig(cfg *config.Config) {
+	s.config.Store(cfg)
 }
 
 func (s *WAFService) SetAuditService(auditService *AuditService) {
 	s.auditService = auditService
 }
 
+// SetNotifier enables apply_failed notifications
+func (s *WAFService) SetNotifier(notifier *Notifier) {
+	s.notifier = notifier
+}
+
+func (s *WAFService) SetAuthenticator(authenticator *auth.Authenticator) {
+	s.authenticator = authenticator
+}
+
 func (s *WAFService) GetWAFStatus(ctx context.Context) (*models.WAFStatus, error) {
 	configMap, err := s.k8sClient.GetWAFPolicyConfigMap(ctx)
 	if err != nil {
@@ -50,6 +105,7 @@ func (s *WAFService) GetWAFStatus(ctx context.Context) (*models.WAFStatus, error
             s.logger.Warnf("Failed to unmarshal policies: %v", err)
         } else {
             status.HostPolicies = policies
+            recordPolicyModes(policies)
             if globalPolicy, exists := policies["global"]; exists {
                 status.GlobalPolicy = globalPolicy
             }
@@ -82,8 +138,11 @@ func (s *WAFService) UpdateWAFMode(ctx context.Context, req models.PolicyUpdateR
         policies = make(map[string]models.WAFPolicy)
     }
     ns := req.Namespace
-    if ns == "" { ns = s.config.Kubernetes.DefaultIngressNamespace }
+    if ns == "" { ns = s.config.Load().Kubernetes.DefaultIngressNamespace }
     key := fmt.Sprintf("%s/%s", ns, req.Host)
+    if err := s.authorizeChange(ctx, ns); err != nil {
+        return err
+    }
     policy, exists := policies[key]
     if !exists {
         policy = models.WAFPolicy{
@@ -114,9 +173,10 @@ func (s *WAFService) UpdateWAFMode(ctx context.Context, req models.PolicyUpdateR
 
 	configMap.Data["policies.yaml"] = string(policiesData)
 
-    if err := s.k8sClient.UpdateConfigMap(ctx, s.config.Kubernetes.Namespace, configMap); err != nil {
+    if err := s.k8sClient.UpdateConfigMap(ctx, s.config.Load().Kubernetes.Namespace, configMap); err != nil {
         return fmt.Errorf("failed to update configmap: %w", err)
     }
+	recordPolicyChange("UPDATE_MODE", policies)
 
 	// Log the change
 	if s.auditService != nil {
@@ -124,7 +184,7 @@ func (s *WAFService) UpdateWAFMode(ctx context.Context, req models.PolicyUpdateR
 			"UPDATE_MODE",
 			"waf_policy",
             key,
-            "system",
+            s.auditUser(ctx),
             "",
             "",
             policy,
@@ -153,8 +213,16 @@ func (s *WAFService) UpdateExceptions(ctx context.Context, req models.ExceptionU
         policies = make(map[string]models.WAFPolicy)
     }
     ns := req.Namespace
-    if ns == "" { ns = s.config.Kubernetes.DefaultIngressNamespace }
+    if ns == "" { ns = s.config.Load().Kubernetes.DefaultIngressNamespace }
     key := fmt.Sprintf("%s/%s", ns, req.Host)
+    if err := s.authorizeChange(ctx, ns); err != nil {
+        return err
+    }
+    if !req.TestMode {
+        if err := s.authorizeApply(ctx, ns, req.Host, s.defaultApplyStrategy(), false); err != nil {
+            return err
+        }
+    }
     policy, exists := policies[key]
     if !exists {
         policy = models.WAFPolicy{
@@ -181,9 +249,10 @@ func (s *WAFService) UpdateExceptions(ctx context.Context, req models.ExceptionU
 
 	configMap.Data["policies.yaml"] = string(policiesData)
 
-	if err := s.k8sClient.UpdateConfigMap(ctx, s.config.Kubernetes.Namespace, configMap); err != nil {
+	if err := s.k8sClient.UpdateConfigMap(ctx, s.config.Load().Kubernetes.Namespace, configMap); err != nil {
 		return fmt.Errorf("failed to update configmap: %w", err)
 	}
+	recordPolicyChange("UPDATE_EXCEPTIONS", policies)
 
     if !req.TestMode {
         if err := s.applyPolicy(ctx, ns, req.Host, policy); err != nil {
@@ -197,7 +266,7 @@ func (s *WAFService) UpdateExceptions(ctx context.Context, req models.ExceptionU
 			"UPDATE_EXCEPTIONS",
 			"waf_policy",
             key,
-            "system",
+            s.auditUser(ctx),
             "",
             "",
             policy,
@@ -226,8 +295,14 @@ func (s *WAFService) UpdateRules(ctx context.Context, req models.RuleUpdateReque
         policies = make(map[string]models.WAFPolicy)
     }
     ns := req.Namespace
-    if ns == "" { ns = s.config.Kubernetes.DefaultIngressNamespace }
+    if ns == "" { ns = s.config.Load().Kubernetes.DefaultIngressNamespace }
     key := fmt.Sprintf("%s/%s", ns, req.Host)
+    if err := s.authorizeChange(ctx, ns); err != nil {
+        return err
+    }
+    if err := s.authorizeApply(ctx, ns, req.Host, s.defaultApplyStrategy(), false); err != nil {
+        return err
+    }
     policy, exists := policies[key]
     if !exists {
         policy = models.WAFPolicy{
@@ -254,9 +329,10 @@ func (s *WAFService) UpdateRules(ctx context.Context, req models.RuleUpdateReque
 
 	configMap.Data["policies.yaml"] = string(policiesData)
 
-	if err := s.k8sClient.UpdateConfigMap(ctx, s.config.Kubernetes.Namespace, configMap); err != nil {
+	if err := s.k8sClient.UpdateConfigMap(ctx, s.config.Load().Kubernetes.Namespace, configMap); err != nil {
 		return fmt.Errorf("failed to update configmap: %w", err)
 	}
+	recordPolicyChange("UPDATE_RULES", policies)
 
     if err := s.applyPolicy(ctx, ns, req.Host, policy); err != nil {
         return err
@@ -268,7 +344,7 @@ func (s *WAFService) UpdateRules(ctx context.Context, req models.RuleUpdateReque
 			"UPDATE_RULES",
 			"waf_policy",
             key,
-            "system",
+            s.auditUser(ctx),
             "",
             "",
             policy,
@@ -297,24 +373,27 @@ func (s *WAFService) ApplyConfiguration(ctx context.Context, req models.ApplyReq
         return fmt.Errorf("no policies found for host: %s", req.Host)
     }
     ns := req.Namespace
-    if ns == "" { ns = s.config.Kubernetes.DefaultIngressNamespace }
+    if ns == "" { ns = s.config.Load().Kubernetes.DefaultIngressNamespace }
     key := fmt.Sprintf("%s/%s", ns, req.Host)
+    if err := s.authorizeChange(ctx, ns); err != nil {
+        return err
+    }
+    strategy := "configmap"
+    if req.Strategy == "annotation" {
+        strategy = "annotation"
+    }
+    if err := s.authorizeApply(ctx, ns, req.Host, strategy, true); err != nil {
+        return err
+    }
     policy, exists := policies[key]
     if !exists {
         return fmt.Errorf("no policy found for host: %s in namespace: %s", req.Host, ns)
     }
 
-    if req.Strategy == "annotation" {
-        if err := s.k8sClient.ApplyWAFPolicyToIngress(ctx, ns, req.Host, policy); err != nil {
-            return fmt.Errorf("failed to apply policy to ingress: %w", err)
-        }
-    } else {
-        if err := s.k8sClient.ApplyWAFPolicyToController(ctx, policy); err != nil {
-            return fmt.Errorf("failed to apply policy to controller: %w", err)
-        }
-    }
-
-    if err := s.k8sClient.RolloutDeployment(ctx, s.config.Kubernetes.IngressControllerNamespace, s.config.Kubernetes.IngressControllerDeploymentName); err != nil {
+    err = s.applyConfiguration(ctx, ns, req.Host, strategy, policy)
+    recordApply(strategy, err)
+    if err != nil {
+        s.notifyApplyFailure(ctx, ns, req.Host, strategy, err)
         return err
     }
 
@@ -324,7 +403,7 @@ func (s *WAFService) ApplyConfiguration(ctx context.Context, req models.ApplyReq
 			"APPLY_CONFIGURATION",
 			"waf_policy",
             key,
-            "system",
+            s.auditUser(ctx),
             req.Strategy,
             "",
             policy,
@@ -338,9 +417,156 @@ func (s *WAFService) ApplyConfiguration(ctx context.Context, req models.ApplyReq
 	return nil
 }
 
+// applyConfiguration applies a policy with the requested strategy and rolls
+// out the ingress controller so it picks up the change
+func (s *WAFService) applyConfiguration(ctx context.Context, namespace, host, strategy string, policy models.WAFPolicy) error {
+	if strategy == "annotation" {
+		if err := s.k8sClient.ApplyWAFPolicyToIngress(ctx, namespace, host, policy); err != nil {
+			return fmt.Errorf("failed to apply policy to ingress: %w", err)
+		}
+	} else {
+		if err := s.k8sClient.ApplyWAFPolicyToController(ctx, policy); err != nil {
+			return fmt.Errorf("failed to apply policy to controller: %w", err)
+		}
+	}
+
+	cfg := s.config.Load()
+	return s.k8sClient.RolloutDeployment(ctx, cfg.Kubernetes.IngressControllerNamespace, cfg.Kubernetes.IngressControllerDeploymentName)
+}
+
+// defaultApplyStrategy returns the strategy applyPolicy uses
+func (s *WAFService) defaultApplyStrategy() string {
+	if s.config.Load().Kubernetes.DefaultApplyStrategy == "configmap" {
+		return "configmap"
+	}
+	return "annotation"
+}
+
 func (s *WAFService) applyPolicy(ctx context.Context, namespace string, host string, policy models.WAFPolicy) error {
-    if s.config.Kubernetes.DefaultApplyStrategy == "configmap" {
-        return s.k8sClient.ApplyWAFPolicyToController(ctx, policy)
-    }
-    return s.k8sClient.ApplyWAFPolicyToIngress(ctx, namespace, host, policy)
-}
\ No newline at end of file
+	var err error
+	strategy := s.defaultApplyStrategy()
+	if strategy == "configmap" {
+		err = s.k8sClient.ApplyWAFPolicyToController(ctx, policy)
+	} else {
+		err = s.k8sClient.ApplyWAFPolicyToIngress(ctx, namespace, host, policy)
+	}
+	recordApply(strategy, err)
+	if err != nil {
+		s.notifyApplyFailure(ctx, namespace, host, strategy, err)
+	}
+	return err
+}
+
+func (s *WAFService) notifyApplyFailure(ctx context.Context, namespace, host, strategy string, err error) {
+	if s.notifier == nil {
+		return
+	}
+	s.notifier.Notify(models.NotificationEvent{
+		Type:     models.EventApplyFailed,
+		Severity: "critical",
+		Title:    fmt.Sprintf("WAF policy apply failed: %s/%s", namespace, host),
+		Message:  fmt.Sprintf("Applying the policy with the %s strategy failed: %v", strategy, err),
+		Host:     host,
+		User:     s.auditUser(ctx),
+	})
+}
+
+// recordPolicyModes replaces the per-mode policy gauges with the counts in
+// policies. Policies without a mode are counted as "unset".
+func recordPolicyModes(policies map[string]models.WAFPolicy) {
+	counts := make(map[string]int)
+	for _, policy := range policies {
+		mode := policy.Mode
+		if mode == "" {
+			mode = "unset"
+		}
+		counts[mode]++
+	}
+
+	policiesByMode.Reset()
+	for mode, n := range counts {
+		policiesByMode.WithLabelValues(mode).Set(float64(n))
+	}
+}
+
+func recordPolicyChange(action string, policies map[string]models.WAFPolicy) {
+	policyChanges.WithLabelValues(action).Inc()
+	recordPolicyModes(policies)
+}
+
+func recordApply(strategy string, err error) {
+	if err != nil {
+		policyApplies.WithLabelValues(strategy, "failure").Inc()
+		return
+	}
+	policyApplies.WithLabelValues(strategy, "success").Inc()
+	now := time.Now()
+	lastApplyUnix.Store(now.Unix())
+	lastApplySuccess.Set(float64(now.Unix()))
+}
+
+// authorizeChange verifies that callers authenticated with their own
+// Kubernetes token may modify Ingresses in the target namespace. The policy
+// itself is stored in the waf-policies ConfigMap with the service account's
+// rights; access to a host's policy follows access to its Ingresses.
+func (s *WAFService) authorizeChange(ctx context.Context, namespace string) error {
+	if s.authenticator == nil {
+		return nil
+	}
+	return s.authenticator.AuthorizeIngressChange(ctx, namespace, "update")
+}
+
+// authorizeApply verifies that callers authenticated with their own
+// Kubernetes token may make the changes an apply makes beyond updating an
+// Ingress: the annotation strategy creates an Ingress when none has a rule
+// for the host, the configmap strategy updates the controller ConfigMap,
+// and a rollout restarts the controller Deployment, the latter two in
+// kubernetes.ingress_controller_namespace.
+func (s *WAFService) authorizeApply(ctx context.Context, namespace, host, strategy string, rollout bool) error {
+	if s.authenticator == nil {
+		return nil
+	}
+	if user, ok := auth.UserFromContext(ctx); !ok || user.Method != auth.MethodKubernetes {
+		return nil
+	}
+	cfg := s.config.Load().Kubernetes
+	if strategy == "annotation" {
+		exists, err := s.k8sClient.HasIngressForHost(ctx, namespace, host)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := s.authenticator.AuthorizeIngressChange(ctx, namespace, "create"); err != nil {
+				return err
+			}
+		}
+	}
+	if strategy == "configmap" {
+		err := s.authenticator.AuthorizeKubernetes(ctx, authorizationv1.ResourceAttributes{
+			Namespace: cfg.IngressControllerNamespace,
+			Verb:      "update",
+			Resource:  "configmaps",
+			Name:      cfg.IngressControllerConfigMapName,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if rollout {
+		return s.authenticator.AuthorizeKubernetes(ctx, authorizationv1.ResourceAttributes{
+			Namespace: cfg.IngressControllerNamespace,
+			Verb:      "patch",
+			Group:     "apps",
+			Resource:  "deployments",
+			Name:      cfg.IngressControllerDeploymentName,
+		})
+	}
+	return nil
+}
+
+func (s *WAFService) auditUser(ctx context.Context) string {
+	if user, ok := auth.UserFromContext(ctx); ok && user.Name != "" {
+		return user.Name
+	}
+	return "system"
+}
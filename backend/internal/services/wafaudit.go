@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"waf-admin/internal/models"
+	"waf-admin/internal/modsecurity"
+)
+
+const (
+	defaultWAFEventsLimit = 50
+	maxWAFEventsLimit     = 500
+	// maxWAFEventsScan bounds the audit log records read for one page when
+	// few of them match the filters
+	maxWAFEventsScan = 10000
+)
+
+// SearchWAFEvents returns ModSecurity audit log records from VictoriaLogs
+// as WAF events, newest first. Filter values are also sent as phrase
+// filters to narrow the records read, but a phrase can match anywhere in a
+// record, so records are parsed and matched exactly here; a page can
+// therefore take several upstream queries.
+func (s *LogsService) SearchWAFEvents(ctx context.Context, query models.WAFEventQuery) (*models.WAFEventsResult, error) {
+	if err := validateWAFEventQuery(&query); err != nil {
+		return nil, err
+	}
+
+	cfg := s.config.Load().Logs
+	conditions := []string{
+		fmt.Sprintf("_time:[%s, %s)", query.TimeRange.Start.Format(time.RFC3339Nano), query.TimeRange.End.Format(time.RFC3339Nano)),
+		"(" + cfg.AuditLogFilter + ")",
+	}
+	for _, value := range []string{query.Host, query.ClientIP, query.RuleID} {
+		if value != "" {
+			conditions = append(conditions, strconv.Quote(value))
+		}
+	}
+	filter := strings.Join(conditions, " AND ")
+
+	result := &models.WAFEventsResult{
+		Events:    []models.WAFEvent{},
+		TimeRange: query.TimeRange,
+	}
+	offset := query.Offset
+	batch := max(query.Limit, 100)
+	for scanned := 0; scanned < maxWAFEventsScan; {
+		page := fmt.Sprintf("%s | sort by (_time desc) | offset %d | limit %d", filter, offset, batch)
+		entries, err := s.queryLogEntries(ctx, cfg.VictoriaLogsURL, page, query.TimeRange)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, entry := range entries {
+			event, err := modsecurity.Parse([]byte(entry.Message))
+			if err != nil {
+				result.Skipped++
+				s.logger.Debugf("Skipping audit log record: %v", err)
+				continue
+			}
+			if event.Timestamp.IsZero() {
+				event.Timestamp = entry.Timestamp
+			}
+			if !matchWAFEvent(event, query) {
+				continue
+			}
+			result.Events = append(result.Events, *event)
+			if len(result.Events) == query.Limit {
+				result.NextOffset = offset + i + 1
+				result.HasMore = i+1 < len(entries) || len(entries) == batch
+				return result, nil
+			}
+		}
+
+		offset += len(entries)
+		scanned += len(entries)
+		if len(entries) < batch {
+			result.NextOffset = offset
+			return result, nil
+		}
+	}
+
+	// The scan limit was reached; the client continues from here
+	result.NextOffset = offset
+	result.HasMore = true
+	return result, nil
+}
+
+func validateWAFEventQuery(query *models.WAFEventQuery) error {
+	if query.Limit == 0 {
+		query.Limit = defaultWAFEventsLimit
+	}
+	if query.Limit < 0 || query.Limit > maxWAFEventsLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d, got %d", ErrInvalidLogQuery, maxWAFEventsLimit, query.Limit)
+	}
+	if query.Offset < 0 {
+		return fmt.Errorf("%w: offset must not be negative, got %d", ErrInvalidLogQuery, query.Offset)
+	}
+	if query.TimeRange.Start.IsZero() || query.TimeRange.End.IsZero() {
+		query.TimeRange.End = time.Now()
+		query.TimeRange.Start = query.TimeRange.End.Add(-defaultLogSearchWindow)
+	}
+	if query.ClientIP != "" && net.ParseIP(query.ClientIP) == nil {
+		return fmt.Errorf("%w: %q is not an IP address", ErrInvalidLogQuery, query.ClientIP)
+	}
+	if query.RuleID != "" && !ruleIDPattern.MatchString(query.RuleID) {
+		return fmt.Errorf("%w: rule ID %q must be numeric", ErrInvalidLogQuery, query.RuleID)
+	}
+	switch query.Action {
+	case "", models.WAFActionBlocked, models.WAFActionDetected, models.WAFActionPassed:
+	default:
+		return fmt.Errorf("%w: action must be %s, %s or %s, got %q", ErrInvalidLogQuery,
+			models.WAFActionBlocked, models.WAFActionDetected, models.WAFActionPassed, query.Action)
+	}
+	return nil
+}
+
+func matchWAFEvent(event *models.WAFEvent, query models.WAFEventQuery) bool {
+	if query.Host != "" && !strings.EqualFold(event.Host, query.Host) {
+		return false
+	}
+	if query.ClientIP != "" && event.ClientIP != query.ClientIP {
+		return false
+	}
+	if query.Action != "" && event.Action != query.Action {
+		return false
+	}
+	if query.RuleID != "" {
+		for _, rule := range event.Rules {
+			if rule.ID == query.RuleID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
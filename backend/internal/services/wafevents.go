@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"waf-admin/internal/config"
+	"waf-admin/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	wafBlockedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "waf_blocked_total",
+		Help: "Requests blocked by a ModSecurity intervention.",
+	}, []string{"host", "rule_id", "severity"})
+	wafDetectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "waf_detected_total",
+		Help: "ModSecurity rule matches that did not block the request, e.g. in DetectionOnly mode.",
+	}, []string{"host", "rule_id", "severity"})
+	wafEventsLastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "waf_events_last_success_timestamp_seconds",
+		Help: "End of the last log window exported to the WAF event counters.",
+	})
+)
+
+// maxWAFEventsWindow bounds how much backlog one poll catches up on after
+// VictoriaLogs was unreachable
+const maxWAFEventsWindow = time.Hour
+
+// modSecuritySeverities maps the numeric severities logged by libmodsecurity
+// to the names used in rule definitions
+var modSecuritySeverities = map[string]string{
+	"0": "emergency",
+	"1": "alert",
+	"2": "critical",
+	"3": "error",
+	"4": "warning",
+	"5": "notice",
+	"6": "info",
+	"7": "debug",
+}
+
+// WAFEventsExporter derives WAF block and detection counters from the
+// ModSecurity messages in VictoriaLogs. Each poll aggregates one half-open
+// time window, so every message is counted exactly once as long as it is
+// ingested within the configured lag.
+type WAFEventsExporter struct {
+	config atomic.Pointer[config.Config]
+	logger *logrus.Logger
+	client *http.Client
+}
+
+func NewWAFEventsExporter(cfg *config.Config, logger *logrus.Logger) *WAFEventsExporter {
+	e := &WAFEventsExporter{
+		logger: logger,
+		client: newUpstreamClient(upstreamVictoriaLogs),
+	}
+	e.config.Store(cfg)
+	return e
+}
+
+// UpdateConfig swaps in a reloaded configuration
+func (e *WAFEventsExporter) UpdateConfig(cfg *config.Config) {
+	e.config.Store(cfg)
+}
+
+// Run polls VictoriaLogs until ctx is cancelled. Counting starts at the
+// moment Run is called; earlier messages are not replayed.
+func (e *WAFEventsExporter) Run(ctx context.Context) {
+	cursor := time.Now().Add(-e.config.Load().Metrics.WAFEvents.Lag).Truncate(time.Second)
+
+	for {
+		cfg := e.config.Load().Metrics.WAFEvents
+		interval := cfg.PollInterval
+		if interval <= 0 {
+			interval = 30 * time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		end := time.Now().Add(-cfg.Lag).Truncate(time.Second)
+		if !cfg.Enabled {
+			cursor = end
+			continue
+		}
+		if !end.After(cursor) {
+			continue
+		}
+		if end.Sub(cursor) > maxWAFEventsWindow {
+			e.logger.Warnf("WAF event export skipped %s of logs after VictoriaLogs was unavailable", end.Sub(cursor)-maxWAFEventsWindow)
+			cursor = end.Add(-maxWAFEventsWindow)
+		}
+
+		if err := e.export(ctx, models.TimeRange{Start: cursor, End: end}); err != nil {
+			e.logger.Warnf("Failed to export WAF events, retrying the window on the next poll: %v", err)
+			continue
+		}
+		cursor = end
+		wafEventsLastSuccess.Set(float64(end.Unix()))
+	}
+}
+
+func (e *WAFEventsExporter) export(ctx context.Context, window models.TimeRange) error {
+	cfg := e.config.Load()
+	query := fmt.Sprintf("_time:[%s, %s) (%s) | %s | %s | %s | %s | stats by (outcome, req_host, rule_id, severity) count() hits",
+		window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339), cfg.Logs.ModSecurityFilter,
+		extractOutcome, extractHost, extractRuleID, extractSeverity)
+
+	rows, err := queryLogStats(ctx, e.client, cfg.Logs.VictoriaLogsURL, query, window)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		hits, err := strconv.ParseFloat(row["hits"], 64)
+		if err != nil || hits <= 0 {
+			continue
+		}
+
+		severity := row["severity"]
+		if name, ok := modSecuritySeverities[severity]; ok {
+			severity = name
+		}
+		labels := prometheus.Labels{
+			"host":     row["req_host"],
+			"rule_id":  row["rule_id"],
+			"severity": strings.ToLower(severity),
+		}
+
+		switch {
+		case strings.HasPrefix(row["outcome"], "Access denied"):
+			wafBlockedTotal.With(labels).Add(hits)
+		case row["outcome"] == "Warning":
+			wafDetectedTotal.With(labels).Add(hits)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+// Methods the backend does not check for a CSRF token
+const SAFE_METHODS = ['GET', 'HEAD', 'OPTIONS']
+
+const CSRF_COOKIE = 'waf_csrf'
+
+// csrfToken reads the CSRF token the backend sets alongside the session
+// cookie
+export function csrfToken(): string | undefined {
+  const prefix = `${CSRF_COOKIE}=`
+  const cookie = document.cookie.split('; ').find((c) => c.startsWith(prefix))
+  return cookie ? decodeURIComponent(cookie.slice(prefix.length)) : undefined
+}
+
+// apiFetch calls the backend API. State-changing requests echo the CSRF
+// cookie in the X-CSRF-Token header, which the backend requires for
+// session cookie logins.
+export function apiFetch(input: string, init: RequestInit = {}): Promise<Response> {
+  const method = (init.method || 'GET').toUpperCase()
+  const headers = new Headers(init.headers)
+  if (!SAFE_METHODS.includes(method)) {
+    const token = csrfToken()
+    if (token) {
+      headers.set('X-CSRF-Token', token)
+    }
+  }
+  return fetch(input, { ...init, headers, credentials: 'same-origin' })
+}
@@ -1,6 +1,7 @@
 import React, { useState, useEffect } from 'react'
 import { Card, CardContent, CardHeader, CardTitle } from '../components/ui/Card'
 import { AlertTriangle, CheckCircle, Clock, Plus, Edit, Trash2 } from 'lucide-react'
+import { apiFetch } from '../lib/api'
 
 interface AlertRule {
   id: string
@@ -39,7 +40,7 @@ const Alerts: React.FC = () => {
 
   const fetchRules = async () => {
     try {
-      const response = await fetch('/api/alerts/rules')
+      const response = await apiFetch('/api/alerts/rules')
       if (!response.ok) {
         console.warn('Alert rules API not available, using empty data')
         setRules([])
@@ -55,7 +56,7 @@ const Alerts: React.FC = () => {
 
   const fetchAlerts = async () => {
     try {
-      const response = await fetch('/api/alerts')
+      const response = await apiFetch('/api/alerts')
       if (!response.ok) {
         console.warn('Alerts API not available, using empty data')
         setAlerts([])
@@ -23,7 +23,7 @@ const Logs: React.FC = () => {
   const handleSearch = async () => {
     setLoading(true)
     const searchQuery = {
-      query: buildQuery(),
+      ...buildFilters(),
       time_range: {
         start: filters.startTime,
         end: filters.endTime
@@ -35,15 +35,13 @@ const Logs: React.FC = () => {
     setLoading(false)
   }
 
-  const buildQuery = () => {
-    const conditions = []
-    if (query) conditions.push(`_msg:*${query}*`)
-    if (filters.status) conditions.push(`status:${filters.status}`)
-    if (filters.host) conditions.push(`host:${filters.host}`)
-    if (filters.rule_id) conditions.push(`rule_id:${filters.rule_id}`)
-    
-    return conditions.length > 0 ? conditions.join(' AND ') : '*'
-  }
+  // Typed filters are quoted by the backend; raw LogsQL is not sent
+  const buildFilters = () => ({
+    text: query || undefined,
+    status: filters.status ? [{ min: Number(filters.status) }] : undefined,
+    hosts: filters.host ? [filters.host] : undefined,
+    rule_ids: filters.rule_id ? [filters.rule_id] : undefined
+  })
 
   const getStatusColor = (status: number) => {
     if (status >= 200 && status < 300) return 'text-green-600'
@@ -3,6 +3,7 @@ import { Card, CardContent, CardHeader, CardTitle } from '../components/ui/Card'
 import { Shield, Plus, Edit, Trash2, Play, Pause } from 'lucide-react'
 import { useWAFStore } from '../stores/waf'
 import { toast } from 'sonner'
+import { apiFetch } from '../lib/api'
 
 interface PolicyFormData {
   host: string
@@ -44,7 +45,7 @@ const Policies: React.FC = () => {
 
   const handleModeChange = async (host: string, newMode: string) => {
     try {
-      const response = await fetch('/api/waf/mode', {
+      const response = await apiFetch('/api/waf/mode', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ host, mode: newMode })
@@ -63,7 +64,7 @@ const Policies: React.FC = () => {
 
   const handleApplyConfig = async (host: string) => {
     try {
-      const response = await fetch('/api/waf/apply', {
+      const response = await apiFetch('/api/waf/apply', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ host, strategy: 'annotation' })
@@ -84,7 +85,7 @@ const Policies: React.FC = () => {
       // For new policies, we need to create them step by step
       if (!editingPolicy) {
         // Step 1: Set WAF mode for the new host
-        const modeResponse = await fetch('/api/waf/mode', {
+        const modeResponse = await apiFetch('/api/waf/mode', {
           method: 'POST',
           headers: { 'Content-Type': 'application/json' },
           body: JSON.stringify({ 
@@ -103,7 +104,7 @@ const Policies: React.FC = () => {
         if (formData.exceptions.paths.length > 0 || 
             formData.exceptions.methods.length > 0 || 
             formData.exceptions.ip_allow.length > 0) {
-          const exceptionsResponse = await fetch('/api/waf/exceptions', {
+          const exceptionsResponse = await apiFetch('/api/waf/exceptions', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({
@@ -123,7 +124,7 @@ const Policies: React.FC = () => {
 
         // Step 3: Add custom rules if any
         if (formData.custom_rules.length > 0) {
-          const rulesResponse = await fetch('/api/waf/rules', {
+          const rulesResponse = await apiFetch('/api/waf/rules', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({
@@ -141,7 +142,7 @@ const Policies: React.FC = () => {
         toast.success('Policy created successfully')
       } else {
         // For existing policies, update mode and other settings
-        const modeResponse = await fetch('/api/waf/mode', {
+        const modeResponse = await apiFetch('/api/waf/mode', {
           method: 'POST',
           headers: { 'Content-Type': 'application/json' },
           body: JSON.stringify({ 
@@ -1,5 +1,6 @@
 import { create } from 'zustand'
 import { devtools } from 'zustand/middleware'
+import { apiFetch } from '../lib/api'
 
 interface WAFPolicy {
   id: string
@@ -87,8 +88,21 @@ interface LogEntry {
   method: string
 }
 
+interface StatusRange {
+  min: number
+  max?: number
+}
+
 interface LogQuery {
-  query: string
+  query?: string
+  advanced?: boolean
+  hosts?: string[]
+  status?: StatusRange[]
+  methods?: string[]
+  client_ips?: string[]
+  rule_ids?: string[]
+  path_prefix?: string
+  text?: string
   time_range: TimeRange
   limit: number
   offset: number
@@ -97,6 +111,7 @@ interface LogQuery {
 interface LogSearchResult {
   entries: LogEntry[]
   total: number
+  has_more: boolean
   time_range: TimeRange
 }
 
@@ -169,7 +184,7 @@ export const useWAFStore = create<WAFStore>()(
         set({ loading: true, error: null })
         try {
           // This would be replaced with actual API call
-          const response = await fetch('/api/waf/status')
+          const response = await apiFetch('/api/waf/status')
           const data = await response.json()
           set({ status: data, loading: false })
         } catch (error) {
@@ -184,7 +199,7 @@ export const useWAFStore = create<WAFStore>()(
             start: timeRange.start,
             end: timeRange.end
           })
-          const response = await fetch(`/api/metrics/summary?${params}`)
+          const response = await apiFetch(`/api/metrics/summary?${params}`)
           const data = await response.json()
           set({ metrics: data, loading: false })
         } catch (error) {
@@ -195,7 +210,7 @@ export const useWAFStore = create<WAFStore>()(
       searchLogs: async (query) => {
         set({ loading: true, error: null })
         try {
-          const response = await fetch('/api/logs/search', {
+          const response = await apiFetch('/api/logs/search', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify(query)
@@ -214,7 +229,7 @@ export const useWAFStore = create<WAFStore>()(
             limit: limit.toString(),
             offset: offset.toString()
           })
-          const response = await fetch(`/api/audit?${params}`)
+          const response = await apiFetch(`/api/audit?${params}`)
           const data = await response.json()
           set({ auditLogs: data, loading: false })
         } catch (error) {